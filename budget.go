@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// BudgetConfig configures the latency budget, when the rolling detection
+// latency exceeds Budget the detector degrades its quality one level at a
+// time and restores it once the latency is below Headroom of the budget
+type BudgetConfig struct {
+	// Budget is the target detection time per frame, zero disables the budget
+	Budget time.Duration
+	// Headroom is the fraction of the budget the latency must fall below
+	// before quality is restored
+	Headroom float64
+	// Window is the number of frames in the rolling latency
+	Window int
+}
+
+// Validate returns an error when the budget settings are out of range
+func (c BudgetConfig) Validate() error {
+	if c.Budget < 0 {
+		return fmt.Errorf("latency budget must not be negative")
+	}
+
+	if c.Headroom <= 0 || c.Headroom >= 1 {
+		return fmt.Errorf("latency headroom must be between 0 and 1")
+	}
+
+	if c.Window < 1 {
+		return fmt.Errorf("latency window must be at least 1 frame")
+	}
+
+	return nil
+}
+
+// qualityLevels are applied in order as the latency exceeds the budget, each
+// level lowers the resolution, coarsens the scale step or skips verification
+var qualityLevels = []searchParams{
+	fullSearch,
+	withSearch(fullSearch, 0.75, 1.03, false),
+	withSearch(fullSearch, 0.75, 1.1, false),
+	withSearch(fullSearch, 0.5, 1.1, false),
+	withSearch(fullSearch, 0.5, 1.1, true),
+}
+
+func withSearch(p searchParams, resize, scale float64, skipVerify bool) searchParams {
+	p.resize = resize
+	p.scale = scale
+	p.skipVerify = skipVerify
+
+	return p
+}
+
+// budgetController tracks the detection latency and selects the quality level
+type budgetController struct {
+	config  BudgetConfig
+	level   int
+	samples []time.Duration
+}
+
+// params returns the search settings for the active quality level
+func (b *budgetController) params() searchParams {
+	return qualityLevels[b.level]
+}
+
+// record adds the latency of a frame and changes the quality level when the
+// rolling latency is outside the budget
+func (b *budgetController) record(latency time.Duration) {
+	if b.config.Budget <= 0 {
+		return
+	}
+
+	b.samples = append(b.samples, latency)
+	if len(b.samples) < b.config.Window {
+		return
+	}
+
+	var total time.Duration
+	for _, s := range b.samples {
+		total += s
+	}
+
+	rolling := total / time.Duration(len(b.samples))
+	headroom := time.Duration(float64(b.config.Budget) * b.config.Headroom)
+
+	switch {
+	case rolling > b.config.Budget && b.level < len(qualityLevels)-1:
+		b.level++
+	case rolling < headroom && b.level > 0:
+		b.level--
+	default:
+		b.samples = b.samples[1:]
+		return
+	}
+
+	// measure the new level before making another change
+	b.samples = b.samples[:0]
+	metricQualityLevel.Set(int64(b.level))
+}
+
+// scaling maps coordinates in a resized frame back to the original frame
+type scaling float64
+
+func (s scaling) pointToFrame(p image.Point) image.Point {
+	return image.Point{X: int(float64(p.X) / float64(s)), Y: int(float64(p.Y) / float64(s))}
+}
+
+func (s scaling) rectToFrame(r image.Rectangle) image.Rectangle {
+	return image.Rectangle{Min: s.pointToFrame(r.Min), Max: s.pointToFrame(r.Max)}
+}
+
+// scalePoint scales a size, keeping it at least one pixel
+func scalePoint(p image.Point, s float64) image.Point {
+	return image.Point{X: maxInt(int(float64(p.X)*s), 1), Y: maxInt(int(float64(p.Y)*s), 1)}
+}
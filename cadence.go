@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// CadenceConfig configures the adaptive detection cadence, frames are
+// processed at MaxRate while faces are being seen and the rate decays towards
+// MinRate once no face has been seen for IdleAfter
+type CadenceConfig struct {
+	Enabled bool
+	// MinRate and MaxRate are the floor and ceiling in frames per second
+	MinRate   float64
+	MaxRate   float64
+	IdleAfter time.Duration
+}
+
+// Validate checks the cadence settings, a rate of zero would stop frames
+// being processed and a face could never be seen to raise the rate again
+func (c CadenceConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.MinRate <= 0 || c.MinRate > c.MaxRate {
+		return fmt.Errorf("cadence min rate must be greater than 0 and at most the max rate")
+	}
+
+	// the idle time is also the decay time constant so it can not be 0
+	if c.IdleAfter <= 0 {
+		return fmt.Errorf("cadence idle after must be greater than 0")
+	}
+
+	return nil
+}
+
+// latencySmoothing is the weight given to the latest latency measurement
+const latencySmoothing = 0.2
+
+// Scheduler decides which frames are processed based on recent detection
+// activity and the measured processing latency
+type Scheduler struct {
+	config CadenceConfig
+
+	mutex    sync.Mutex
+	last     time.Time // time the last frame was processed
+	lastFace time.Time // time a verified face was last seen
+	latency  float64   // smoothed processing time in seconds
+}
+
+// NewScheduler creates a scheduler, faces are assumed to be present when it
+// starts so that the first frames are processed at the full rate
+func NewScheduler(config CadenceConfig) *Scheduler {
+	return &Scheduler{
+		config:   config,
+		lastFace: time.Now(),
+	}
+}
+
+// Allow returns true if a frame received at now should be processed
+func (s *Scheduler) Allow(now time.Time) bool {
+	if !s.config.Enabled {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rate := s.rate(now)
+	metricProcessingRate.Set(rate)
+
+	if now.Sub(s.last).Seconds() < 1/rate {
+		metricFramesSkipped.Add(1)
+		return false
+	}
+
+	s.last = now
+	return true
+}
+
+// Record updates the scheduler with the result of processing a frame
+func (s *Scheduler) Record(now time.Time, latency time.Duration, faceFound bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if faceFound {
+		s.lastFace = now
+	}
+
+	if s.latency == 0 {
+		s.latency = latency.Seconds()
+	} else {
+		s.latency = latencySmoothing*latency.Seconds() + (1-latencySmoothing)*s.latency
+	}
+}
+
+// rate returns the current processing rate in frames per second
+func (s *Scheduler) rate(now time.Time) float64 {
+	rate := s.config.MaxRate
+
+	// decay exponentially towards the floor once the scene has been idle
+	if idle := now.Sub(s.lastFace) - s.config.IdleAfter; idle > 0 {
+		rate = s.config.MaxRate * math.Exp(-idle.Seconds()/s.config.IdleAfter.Seconds())
+	}
+
+	// there is no benefit in scheduling frames faster than they can be processed
+	if s.latency > 0 {
+		rate = math.Min(rate, 1/s.latency)
+	}
+
+	return math.Max(rate, s.config.MinRate)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+)
+
+// MessageDroneImageChunk is the name of a message containing part of a drone
+// image which is too large to be sent as a single NATS message
+const MessageDroneImageChunk = "image.chunk"
+
+// minChunkSize is the smallest chunk, other than the last chunk of a frame,
+// which publishers are expected to send, it limits the number of chunks a
+// frame can be split into
+const minChunkSize = 1024
+
+// chunkOverhead is the memory held for each expected chunk of a frame before
+// its data is received, the size of a slice header
+const chunkOverhead = 24
+
+var (
+	errInvalidChunk     = errors.New("invalid chunk")
+	errChecksumMismatch = errors.New("frame checksum does not match")
+)
+
+// FrameChunk is part of a frame, publishers gob encode a struct with these
+// fields for each chunk. The chunks of a frame are reassembled in order of
+// Index, every chunk other than the last must be at least minChunkSize bytes
+// and the Checksum is the crc32 of the complete frame data
+type FrameChunk struct {
+	FrameID  string
+	Index    int
+	Count    int
+	Checksum uint32
+	Data     []byte // part of the gzipped frame data
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (fc *FrameChunk) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(fc)
+}
+
+type partialFrame struct {
+	started  time.Time
+	checksum uint32
+	chunks   [][]byte
+	received int
+	size     int
+}
+
+// ChunkAssembler reassembles frames from their chunks, frames which are not
+// complete within the timeout are discarded, as are the oldest incomplete
+// frames when the data held exceeds maxBytes
+type ChunkAssembler struct {
+	timeout  time.Duration
+	maxBytes int
+
+	mutex  sync.Mutex
+	frames map[string]*partialFrame
+	size   int
+}
+
+// NewChunkAssembler creates a new ChunkAssembler
+func NewChunkAssembler(timeout time.Duration, maxBytes int) *ChunkAssembler {
+	return &ChunkAssembler{
+		timeout:  timeout,
+		maxBytes: maxBytes,
+		frames:   make(map[string]*partialFrame),
+	}
+}
+
+// validateChunkSettings checks the chunk assembler settings, partial frames
+// must be kept for some time and there must be room for a frame of more than
+// one chunk
+func validateChunkSettings(timeout time.Duration, maxBytes int) error {
+	if timeout <= 0 {
+		return fmt.Errorf("chunk timeout must be greater than 0")
+	}
+
+	if maxBytes < 2*minChunkSize {
+		return fmt.Errorf("chunk max memory must be at least %d bytes", 2*minChunkSize)
+	}
+
+	return nil
+}
+
+// maxChunks is the largest number of chunks a frame can be split into
+func (ca *ChunkAssembler) maxChunks() int {
+	return maxInt(ca.maxBytes/minChunkSize, 1)
+}
+
+// Add adds a chunk to its frame, when the frame is complete the reassembled
+// data is returned
+func (ca *ChunkAssembler) Add(fc *FrameChunk) ([]byte, error) {
+	if fc.FrameID == "" || fc.Count < 1 || fc.Count > ca.maxChunks() || fc.Index < 0 || fc.Index >= fc.Count {
+		return nil, errInvalidChunk
+	}
+
+	if len(fc.Data) == 0 || len(fc.Data) > ca.maxBytes {
+		return nil, errInvalidChunk
+	}
+
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	ca.expire(time.Now())
+	metricChunksReceived.Add(1)
+
+	pf, ok := ca.frames[fc.FrameID]
+	if !ok {
+		pf = &partialFrame{
+			started:  time.Now(),
+			checksum: fc.Checksum,
+			chunks:   make([][]byte, fc.Count),
+			size:     fc.Count * chunkOverhead,
+		}
+		ca.frames[fc.FrameID] = pf
+		ca.size += pf.size
+	}
+
+	if len(pf.chunks) != fc.Count || pf.checksum != fc.Checksum {
+		ca.discard(fc.FrameID, "invalid")
+		return nil, errInvalidChunk
+	}
+
+	// duplicate chunks are ignored
+	if pf.chunks[fc.Index] != nil {
+		return nil, nil
+	}
+
+	pf.chunks[fc.Index] = fc.Data
+	pf.received++
+	pf.size += len(fc.Data)
+	ca.size += len(fc.Data)
+
+	if pf.received < len(pf.chunks) {
+		ca.evict()
+		return nil, nil
+	}
+
+	data := bytes.Join(pf.chunks, nil)
+	ca.remove(fc.FrameID)
+
+	if crc32.ChecksumIEEE(data) != pf.checksum {
+		metricChunkedFramesDiscard.Add("checksum", 1)
+		return nil, errChecksumMismatch
+	}
+
+	metricChunkedFramesComplete.Add(1)
+	return data, nil
+}
+
+// Expire discards any incomplete frames which have exceeded the timeout
+func (ca *ChunkAssembler) Expire() {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	ca.expire(time.Now())
+}
+
+func (ca *ChunkAssembler) expire(now time.Time) {
+	for id, pf := range ca.frames {
+		if now.Sub(pf.started) > ca.timeout {
+			ca.discard(id, "timeout")
+		}
+	}
+}
+
+// evict discards the oldest frames until the data held is within the limit
+func (ca *ChunkAssembler) evict() {
+	for ca.size > ca.maxBytes && len(ca.frames) > 0 {
+		var oldest string
+		for id, pf := range ca.frames {
+			if oldest == "" || pf.started.Before(ca.frames[oldest].started) {
+				oldest = id
+			}
+		}
+
+		ca.discard(oldest, "memory")
+	}
+}
+
+func (ca *ChunkAssembler) discard(id, reason string) {
+	ca.remove(id)
+	metricChunkedFramesDiscard.Add(reason, 1)
+}
+
+func (ca *ChunkAssembler) remove(id string) {
+	if pf, ok := ca.frames[id]; ok {
+		ca.size -= pf.size
+		delete(ca.frames, id)
+	}
+}
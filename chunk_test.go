@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// splitFrame splits data into chunks of size bytes as a publisher would
+func splitFrame(frameID string, data []byte, size int) []FrameChunk {
+	count := (len(data) + size - 1) / size
+	sum := crc32.ChecksumIEEE(data)
+
+	chunks := make([]FrameChunk, 0, count)
+	for i := 0; i < count; i++ {
+		end := minInt((i+1)*size, len(data))
+		chunks = append(chunks, FrameChunk{FrameID: frameID, Index: i, Count: count, Checksum: sum, Data: data[i*size : end]})
+	}
+
+	return chunks
+}
+
+func testFrame(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+func TestReassemblesChunksInAnyOrder(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 1<<20)
+	data := testFrame(5000)
+	chunks := splitFrame("a", data, minChunkSize)
+
+	var out []byte
+	for i := len(chunks) - 1; i >= 0; i-- {
+		var err error
+		if out, err = ca.Add(&chunks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.Equal(out, data) {
+		t.Error("reassembled frame does not match")
+	}
+}
+
+func TestIgnoresDuplicateChunks(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 1<<20)
+	chunks := splitFrame("a", testFrame(3000), minChunkSize)
+
+	ca.Add(&chunks[0])
+	if out, err := ca.Add(&chunks[0]); out != nil || err != nil {
+		t.Errorf("expected duplicate to be ignored, got %v %v", out, err)
+	}
+}
+
+func TestRejectsChecksumMismatch(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 1<<20)
+	chunks := splitFrame("a", testFrame(2000), minChunkSize)
+	chunks[1].Data = testFrame(len(chunks[1].Data) + 1)[1:]
+
+	ca.Add(&chunks[0])
+	if _, err := ca.Add(&chunks[1]); err != errChecksumMismatch {
+		t.Errorf("expected %s, got %v", errChecksumMismatch, err)
+	}
+}
+
+func TestRejectsInvalidChunks(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 1<<20)
+
+	for _, fc := range []FrameChunk{
+		{FrameID: "", Index: 0, Count: 1, Data: []byte{1}},
+		{FrameID: "a", Index: 0, Count: 0, Data: []byte{1}},
+		{FrameID: "a", Index: 2, Count: 2, Data: []byte{1}},
+		{FrameID: "a", Index: 0, Count: 1 << 30, Data: []byte{1}},
+		{FrameID: "a", Index: 0, Count: 1},
+		{FrameID: "a", Index: 0, Count: 1, Data: make([]byte, 2<<20)},
+	} {
+		if _, err := ca.Add(&fc); err != errInvalidChunk {
+			t.Errorf("expected %s for count %d index %d, got %v", errInvalidChunk, fc.Count, fc.Index, err)
+		}
+	}
+}
+
+func TestRejectsChangedCount(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 1<<20)
+
+	ca.Add(&FrameChunk{FrameID: "a", Index: 0, Count: 3, Data: []byte{1}})
+	if _, err := ca.Add(&FrameChunk{FrameID: "a", Index: 1, Count: 2, Data: []byte{1}}); err != errInvalidChunk {
+		t.Errorf("expected %s, got %v", errInvalidChunk, err)
+	}
+}
+
+func TestEvictsOldestFramesOverMemoryLimit(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 4*minChunkSize)
+
+	for _, id := range []string{"a", "b", "c"} {
+		chunks := splitFrame(id, testFrame(4*minChunkSize), minChunkSize)
+		ca.Add(&chunks[0])
+		ca.Add(&chunks[1])
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, ok := ca.frames["a"]; ok {
+		t.Error("expected the oldest frame to be evicted")
+	}
+
+	if ca.size > ca.maxBytes {
+		t.Errorf("expected at most %d bytes held, got %d", ca.maxBytes, ca.size)
+	}
+}
+
+func TestCountsExpectedChunksAgainstMemoryLimit(t *testing.T) {
+	ca := NewChunkAssembler(time.Minute, 64*minChunkSize)
+
+	for i := 0; i < 1000; i++ {
+		ca.Add(&FrameChunk{FrameID: string(rune('a' + i)), Index: 0, Count: ca.maxChunks(), Data: []byte{1}})
+	}
+
+	if ca.size > ca.maxBytes {
+		t.Errorf("expected at most %d bytes held, got %d", ca.maxBytes, ca.size)
+	}
+}
+
+func TestExpiresIncompleteFrames(t *testing.T) {
+	ca := NewChunkAssembler(time.Millisecond, 1<<20)
+	chunks := splitFrame("a", testFrame(2000), minChunkSize)
+
+	ca.Add(&chunks[0])
+	time.Sleep(5 * time.Millisecond)
+	ca.Expire()
+
+	if len(ca.frames) != 0 || ca.size != 0 {
+		t.Errorf("expected no frames held, got %d frames and %d bytes", len(ca.frames), ca.size)
+	}
+}
+
+func TestValidatesChunkSettings(t *testing.T) {
+	if err := validateChunkSettings(0, 1<<20); err == nil {
+		t.Error("expected a timeout of 0 to be rejected")
+	}
+
+	if err := validateChunkSettings(time.Second, minChunkSize); err == nil {
+		t.Error("expected memory for a single chunk to be rejected")
+	}
+
+	if err := validateChunkSettings(time.Second, 1<<20); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+
+	"gocv.io/x/gocv"
+)
+
+// TargetMode defines what the drone follows
+type TargetMode string
+
+const (
+	// TargetFace follows verified faces
+	TargetFace TargetMode = "face"
+	// TargetColour follows the largest object within a colour range
+	TargetColour TargetMode = "colour"
+)
+
+// ColourConfig configures the colour blob tracker
+type ColourConfig struct {
+	// Lower and Upper bound the HSV colour range, hue is 0 to 180 and a lower
+	// hue greater than the upper hue wraps around red
+	Lower gocv.Scalar
+	Upper gocv.Scalar
+	// MinArea is the smallest area in pixels of a target
+	MinArea float64
+	// Kernel is the size of the kernel used to clean up the mask
+	Kernel int
+}
+
+// Validate checks the colour tracker settings
+func (c ColourConfig) Validate() error {
+	if c.Kernel < 1 {
+		return fmt.Errorf("colour kernel must be at least 1 pixel")
+	}
+
+	if c.Lower.Val1 < 0 || c.Lower.Val1 > 180 || c.Upper.Val1 < 0 || c.Upper.Val1 > 180 {
+		return fmt.Errorf("colour hue must be between 0 and 180")
+	}
+
+	for _, v := range []float64{c.Lower.Val2, c.Lower.Val3, c.Upper.Val2, c.Upper.Val3} {
+		if v < 0 || v > 255 {
+			return fmt.Errorf("colour saturation and value must be between 0 and 255")
+		}
+	}
+
+	// only the hue wraps around
+	if c.Lower.Val2 > c.Upper.Val2 || c.Lower.Val3 > c.Upper.Val3 {
+		return fmt.Errorf("colour lower saturation and value must not be greater than the upper")
+	}
+
+	if c.MinArea < 0 {
+		return fmt.Errorf("colour min area must not be negative")
+	}
+
+	return nil
+}
+
+// ParseHSV parses a colour given as h,s,v
+func ParseHSV(s string) (gocv.Scalar, error) {
+	values := splitList(s)
+	if len(values) != 3 {
+		return gocv.Scalar{}, fmt.Errorf("invalid colour %s, expected h,s,v", s)
+	}
+
+	hsv := make([]float64, 3)
+	for i, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return gocv.Scalar{}, fmt.Errorf("invalid colour %s: %s", s, err)
+		}
+
+		hsv[i] = f
+	}
+
+	return gocv.NewScalar(hsv[0], hsv[1], hsv[2], 0), nil
+}
+
+// ColourTracker finds a brightly coloured target such as a vest or a ball
+type ColourTracker struct {
+	config ColourConfig
+}
+
+// NewColourTracker creates a tracker for the given settings
+func NewColourTracker(config ColourConfig) *ColourTracker {
+	return &ColourTracker{config: config}
+}
+
+// Detect finds the largest object within the colour range, the target is
+// returned as a verified face so that it is published with the same schema
+func (ct *ColourTracker) Detect(file string) (*Detection, error) {
+	img := gocv.IMRead(file, gocv.IMReadColor)
+	defer img.Close()
+
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	d := &Detection{Bounds: image.Rect(0, 0, img.Cols(), img.Rows())}
+
+	mask := ct.mask(img)
+	defer mask.Close()
+
+	var best []image.Point
+	bestArea := ct.config.MinArea
+	for _, c := range gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple) {
+		if a := gocv.ContourArea(c); a >= bestArea {
+			best = c
+			bestArea = a
+		}
+	}
+
+	if best == nil {
+		return d, nil
+	}
+
+	metricColourTargets.Add(1)
+
+	r := gocv.BoundingRect(best)
+	d.Faces = []Face{{
+		Rect:     r,
+		Verified: true,
+		// the fraction of the bounding rectangle covered by the target
+		Confidence: bestArea / area(r),
+	}}
+
+	return d, nil
+}
+
+// mask returns a binary mask where pixels within the colour range are 255
+func (ct *ColourTracker) mask(img gocv.Mat) gocv.Mat {
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+
+	gocv.CvtColor(img, hsv, gocv.ColorBGRToHSV)
+
+	lower, upper := ct.config.Lower, ct.config.Upper
+
+	mask := gocv.NewMat()
+	if lower.Val1 <= upper.Val1 {
+		inRange(hsv, lower, upper, mask)
+	} else {
+		// the range wraps around the end of the hue circle
+		high := gocv.NewMat()
+		defer high.Close()
+
+		inRange(hsv, lower, gocv.NewScalar(180, upper.Val2, upper.Val3, 0), mask)
+		inRange(hsv, gocv.NewScalar(0, lower.Val2, lower.Val3, 0), upper, high)
+		gocv.BitwiseOr(mask, high, mask)
+	}
+
+	// opening removes speckles and closing fills holes in the target
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Point{X: ct.config.Kernel, Y: ct.config.Kernel})
+	defer kernel.Close()
+
+	gocv.MorphologyEx(mask, mask, gocv.MorphOpen, kernel)
+	gocv.MorphologyEx(mask, mask, gocv.MorphClose, kernel)
+
+	return mask
+}
+
+// inRange sets the pixels of dst to 255 where each channel of src is between
+// the matching channels of lower and upper
+func inRange(src gocv.Mat, lower, upper gocv.Scalar, dst gocv.Mat) {
+	lb := gocv.NewMatFromScalar(lower, matTypeCV8UC3)
+	defer lb.Close()
+	ub := gocv.NewMatFromScalar(upper, matTypeCV8UC3)
+	defer ub.Close()
+
+	gocv.InRange(src, lb, ub, dst)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+var mergeMode = flag.String("merge", "nms", "how overlapping face detections are merged: none, nms or weighted")
+var mergeThreshold = flag.Float64("merge-threshold", 0.3, "minimum intersection over union for two detections to be merged")
+var verifyMode = flag.String("verify", string(DefaultVerificationPolicy.Mode), "rule used to verify faces: none, any, all or weighted")
+var verifyFeatures = flag.String("verify-features", strings.Join(DefaultVerificationPolicy.Features, ","), "comma separated features used by the any and all verification rules")
+var verifyWeights = flag.String("verify-weights", "eyes=0.5,glasses=0.5", "comma separated feature=weight pairs used by the weighted verification rule")
+var verifyThreshold = flag.Float64("verify-threshold", 0.5, "minimum total weight for the weighted verification rule")
+var noseCascade = flag.String("nose-cascade", "", "path to an optional nose cascade used as verification evidence")
+var mouthCascade = flag.String("mouth-cascade", "", "path to an optional mouth cascade used as verification evidence")
+var smileCascade = flag.String("smile-cascade", "", "path to an optional smile cascade used as verification evidence")
+var rotationAngles = flag.String("rotation-angles", "", "comma separated angles in degrees to rotate frames by to find tilted faces i.e. -20,20")
+var profileCascade = flag.String("profile-cascade", "", "path to a profile face cascade i.e. haarcascade_profileface.xml, enables detection of faces turned to the side")
+var roiEnabled = flag.Bool("roi", false, "search around previous detections before scanning the whole frame")
+var roiExpand = flag.Float64("roi-expand", 0.5, "fraction of the face size added to each side of a face to create its search window")
+var roiFullScanInterval = flag.Int("roi-full-scan-interval", 10, "maximum number of frames between full frame scans in roi mode")
+var tileEnabled = flag.Bool("tiles", false, "search high resolution frames in overlapping tiles")
+var tileSize = flag.Int("tile-size", 800, "width and height in pixels of each tile")
+var tileOverlap = flag.Int("tile-overlap", 200, "pixels shared by neighbouring tiles, should be at least the size of the largest face")
+var tileWorkers = flag.Int("tile-workers", runtime.NumCPU(), "number of tiles searched in parallel")
+var skinMode = flag.String("skin", "off", "skin colour filter: off, reject candidate faces with few skin pixels or only search skin coloured regions")
+var skinColorSpace = flag.String("skin-colorspace", "ycrcb", "colour space used to classify skin pixels: hsv or ycrcb")
+var skinMinRatio = flag.Float64("skin-min-ratio", 0.3, "minimum fraction of skin pixels in a face for the reject skin filter")
+var skinMinArea = flag.Float64("skin-min-area", 100, "minimum area in pixels of a skin region for the regions skin filter")
+var staticMode = flag.String("static", "off", "faces which never move relative to the scene: off, mark or drop")
+var staticMaxMotion = flag.Float64("static-max-motion", 0.5, "largest motion in pixels per frame relative to the scene for a face to be considered still")
+var staticFrames = flag.Int("static-frames", 15, "consecutive still frames before a face is considered static")
+var qualityAction = flag.String("quality", "off", "frame quality assessment: off, flag poor frames or skip detection on poor frames")
+var qualityMinSharpness = flag.Float64("quality-min-sharpness", 50, "minimum variance of the Laplacian before a frame is considered blurred")
+var qualityMinBrightness = flag.Float64("quality-min-brightness", 40, "minimum mean brightness, 0 to 255")
+var qualityMaxBrightness = flag.Float64("quality-max-brightness", 215, "maximum mean brightness, 0 to 255")
+var qualityMaxClipped = flag.Float64("quality-max-clipped", 0.25, "maximum fraction of black or white pixels")
+var qualityMinContrast = flag.Float64("quality-min-contrast", 20, "minimum standard deviation of the brightness")
+var exposureHints = flag.Bool("exposure-hints", false, "publish exposure adjustments for the drone camera when frames are poorly exposed")
+var lowLightMode = flag.String("low-light", "off", "low light enhancement: off, auto when frames are darker than the threshold or on")
+var lowLightThreshold = flag.Float64("low-light-threshold", 60, "mean brightness, 0 to 255, below which frames are enhanced in auto mode")
+var lowLightGamma = flag.Float64("low-light-gamma", 1.5, "gamma correction applied to enhanced frames, greater than 1 brightens mid tones")
+var lowLightDenoise = flag.String("low-light-denoise", "bilateral", "filter used to denoise enhanced frames: none, median or bilateral")
+var invertIR = flag.Bool("ir-invert", false, "invert frames from a thermal camera which renders warm objects dark")
+var confirmMode = flag.String("confirm", "off", "temporal confirmation of verified faces: off, mark confirmed faces or filter unconfirmed faces")
+var confirmHits = flag.Int("confirm-hits", 3, "number of recent frames a face must be seen in to be confirmed")
+var confirmWindow = flag.Int("confirm-window", 5, "number of recent frames considered when confirming a face, at most 64")
+var confirmLostAfter = flag.Int("confirm-lost-after", 5, "consecutive missed frames before a confirmed face is lost")
+var latencyBudget = flag.Duration("latency-budget", 0, "target detection time per frame, quality is degraded when exceeded, disabled when 0")
+var latencyHeadroom = flag.Float64("latency-headroom", 0.6, "fraction of the latency budget the latency must fall below before quality is restored")
+var latencyWindow = flag.Int("latency-window", 10, "number of frames in the rolling latency")
+
+// faceProcessorConfig creates the face processor settings from the command
+// line flags
+func faceProcessorConfig() (FaceProcessorConfig, error) {
+	mm, err := ParseMergeMode(*mergeMode)
+	if err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	// at 0 rectangles which do not overlap at all would be merged
+	if *mergeThreshold <= 0 || *mergeThreshold > 1 {
+		return FaceProcessorConfig{}, fmt.Errorf("merge threshold must be greater than 0 and at most 1")
+	}
+
+	policy, err := ParseVerificationPolicy(*verifyMode, *verifyFeatures, *verifyWeights, *verifyThreshold)
+	if err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	angles, err := ParseAngles(*rotationAngles)
+	if err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	tiles := TileConfig{
+		Enabled: *tileEnabled,
+		Size:    *tileSize,
+		Overlap: *tileOverlap,
+		Workers: *tileWorkers,
+	}
+
+	if err := tiles.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	skin := SkinConfig{
+		Mode:          SkinMode(*skinMode),
+		ColorSpace:    *skinColorSpace,
+		MinRatio:      *skinMinRatio,
+		MinRegionArea: *skinMinArea,
+	}
+
+	if err := skin.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	static := StaticConfig{
+		Mode:      StaticMode(*staticMode),
+		MaxMotion: *staticMaxMotion,
+		Frames:    *staticFrames,
+	}
+
+	if err := static.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	quality := QualityConfig{
+		Action:        QualityAction(*qualityAction),
+		MinSharpness:  *qualityMinSharpness,
+		MinBrightness: *qualityMinBrightness,
+		MaxBrightness: *qualityMaxBrightness,
+		MaxClipped:    *qualityMaxClipped,
+		MinContrast:   *qualityMinContrast,
+		ExposureHints: *exposureHints,
+	}
+
+	if err := quality.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	lowLight := LowLightConfig{
+		Mode:      LowLightMode(*lowLightMode),
+		Threshold: *lowLightThreshold,
+		Gamma:     *lowLightGamma,
+		Denoise:   *lowLightDenoise,
+		InvertIR:  *invertIR,
+	}
+
+	if err := lowLight.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	confirm := ConfirmConfig{
+		Mode:      ConfirmMode(*confirmMode),
+		Hits:      *confirmHits,
+		Window:    *confirmWindow,
+		LostAfter: *confirmLostAfter,
+	}
+
+	if err := confirm.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	budget := BudgetConfig{
+		Budget:   *latencyBudget,
+		Headroom: *latencyHeadroom,
+		Window:   *latencyWindow,
+	}
+
+	if err := budget.Validate(); err != nil {
+		return FaceProcessorConfig{}, err
+	}
+
+	return FaceProcessorConfig{
+		MergeMode:      mm,
+		MergeThreshold: *mergeThreshold,
+		Verification:   policy,
+		NoseCascade:    *noseCascade,
+		MouthCascade:   *mouthCascade,
+		SmileCascade:   *smileCascade,
+		RotationAngles: angles,
+		ProfileCascade: *profileCascade,
+		ROI: ROIConfig{
+			Enabled:          *roiEnabled,
+			Expand:           *roiExpand,
+			FullScanInterval: *roiFullScanInterval,
+		},
+		Tiles:    tiles,
+		Skin:     skin,
+		Static:   static,
+		Quality:  quality,
+		LowLight: lowLight,
+		Confirm:  confirm,
+		Budget:   budget,
+	}, nil
+}
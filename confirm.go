@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// ConfirmMode defines how unconfirmed faces are handled
+type ConfirmMode string
+
+const (
+	// ConfirmOff disables temporal confirmation
+	ConfirmOff ConfirmMode = "off"
+	// ConfirmMark sets Confirmed on faces which have been confirmed
+	ConfirmMark ConfirmMode = "mark"
+	// ConfirmFilter removes verified faces which have not been confirmed
+	ConfirmFilter ConfirmMode = "filter"
+)
+
+// ConfirmConfig configures N of M temporal confirmation, a verified face is
+// confirmed once it has been seen in Hits of the last Window frames and is
+// lost after it has been missing for LostAfter consecutive frames
+type ConfirmConfig struct {
+	Mode      ConfirmMode
+	Hits      int
+	Window    int
+	LostAfter int
+}
+
+// Validate checks the confirmation settings
+func (c ConfirmConfig) Validate() error {
+	switch c.Mode {
+	case ConfirmOff, ConfirmMark, ConfirmFilter:
+	default:
+		return fmt.Errorf("unknown confirm mode %s, expected off, mark or filter", c.Mode)
+	}
+
+	if c.Window < 1 || c.Window > 64 || c.Hits < 1 || c.Hits > c.Window {
+		return fmt.Errorf("confirm hits must be between 1 and the window, and the window between 1 and 64")
+	}
+
+	if c.LostAfter < 1 {
+		return fmt.Errorf("confirm lost after must be at least 1 frame")
+	}
+
+	return nil
+}
+
+type confirmTrack struct {
+	id        int
+	rect      image.Rectangle
+	history   uint64 // bit 0 is set when the face was seen in the latest frame
+	misses    int
+	confirmed bool
+}
+
+// confirmer associates verified faces across frames
+type confirmer struct {
+	config ConfirmConfig
+	tracks []*confirmTrack
+	nextID int
+}
+
+// apply associates the accepted faces with the existing tracks and sets
+// their track id and confirmation, confirmed faces which were not found are
+// added at their last position as coasting faces until they are lost
+func (c *confirmer) apply(faces []Face) []Face {
+	matched := make(map[*confirmTrack]bool)
+
+	for i := range faces {
+		f := &faces[i]
+		if !f.Accepted() {
+			continue
+		}
+
+		var track *confirmTrack
+		best := 0.3
+		for _, t := range c.tracks {
+			if iou := IoU(f.Rect, t.rect); !matched[t] && iou >= best {
+				best, track = iou, t
+			}
+		}
+
+		if track == nil {
+			c.nextID++
+			track = &confirmTrack{id: c.nextID}
+			c.tracks = append(c.tracks, track)
+		}
+
+		matched[track] = true
+		track.rect = f.Rect
+		f.TrackID = track.id
+	}
+
+	window := uint64(1)<<uint(c.config.Window) - 1
+	if c.config.Window == 64 {
+		window = ^uint64(0)
+	}
+
+	tracks := make([]*confirmTrack, 0, len(c.tracks))
+	for _, t := range c.tracks {
+		t.history <<= 1
+		if matched[t] {
+			t.history |= 1
+			t.misses = 0
+		} else {
+			t.misses++
+		}
+
+		if !t.confirmed && popCount(t.history&window) >= c.config.Hits {
+			t.confirmed = true
+			metricFacesConfirmed.Add(1)
+		}
+
+		// confirmed faces are kept through short gaps in detection
+		if t.confirmed && t.misses >= c.config.LostAfter {
+			metricFacesLost.Add(1)
+			continue
+		}
+
+		if !t.confirmed && t.history&window == 0 {
+			continue
+		}
+
+		tracks = append(tracks, t)
+	}
+
+	c.tracks = tracks
+
+	confirmed := make(map[int]bool)
+	for _, t := range c.tracks {
+		confirmed[t.id] = t.confirmed
+	}
+
+	fcs := make([]Face, 0, len(faces))
+	for _, f := range faces {
+		f.Confirmed = f.Accepted() && confirmed[f.TrackID]
+
+		if c.config.Mode == ConfirmFilter && f.Accepted() && !f.Confirmed {
+			continue
+		}
+
+		fcs = append(fcs, f)
+	}
+
+	for _, t := range c.tracks {
+		if t.confirmed && !matched[t] {
+			fcs = append(fcs, Face{Rect: t.rect, TrackID: t.id, Confirmed: true, Coasting: true})
+		}
+	}
+
+	return fcs
+}
+
+func popCount(v uint64) int {
+	count := 0
+	for ; v != 0; v &= v - 1 {
+		count++
+	}
+
+	return count
+}
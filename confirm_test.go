@@ -0,0 +1,111 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func verifiedFace(r image.Rectangle) Face {
+	return Face{Rect: r, Verified: true}
+}
+
+type confirmStep struct {
+	seen      bool
+	faces     int
+	confirmed bool
+	coasting  bool
+}
+
+func TestConfirmsFacesAcrossFrames(t *testing.T) {
+	cases := []struct {
+		name  string
+		mode  ConfirmMode
+		steps []confirmStep
+	}{
+		{
+			name: "confirmed after the required hits",
+			mode: ConfirmMark,
+			steps: []confirmStep{
+				{seen: true, faces: 1},
+				{seen: true, faces: 1, confirmed: true},
+			},
+		},
+		{
+			name: "confirmed within the window",
+			mode: ConfirmMark,
+			steps: []confirmStep{
+				{seen: true, faces: 1},
+				{seen: false, faces: 0},
+				{seen: true, faces: 1, confirmed: true},
+			},
+		},
+		{
+			name: "coasting until lost",
+			mode: ConfirmMark,
+			steps: []confirmStep{
+				{seen: true, faces: 1},
+				{seen: true, faces: 1, confirmed: true},
+				{seen: false, faces: 1, confirmed: true, coasting: true},
+				{seen: false, faces: 0},
+			},
+		},
+		{
+			name: "unconfirmed faces are filtered",
+			mode: ConfirmFilter,
+			steps: []confirmStep{
+				{seen: true, faces: 0},
+				{seen: true, faces: 1, confirmed: true},
+				{seen: false, faces: 1, confirmed: true, coasting: true},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		c := &confirmer{config: ConfirmConfig{Mode: tc.mode, Hits: 2, Window: 3, LostAfter: 2}}
+
+		for i, s := range tc.steps {
+			faces := []Face{}
+			if s.seen {
+				faces = append(faces, verifiedFace(image.Rect(10, 10, 50, 50)))
+			}
+
+			fcs := c.apply(faces)
+			if len(fcs) != s.faces {
+				t.Fatalf("%s: frame %d: expected %d faces, got %d", tc.name, i, s.faces, len(fcs))
+			}
+
+			if len(fcs) == 1 && (fcs[0].Confirmed != s.confirmed || fcs[0].Coasting != s.coasting) {
+				t.Errorf("%s: frame %d: expected confirmed %v coasting %v, got %v %v",
+					tc.name, i, s.confirmed, s.coasting, fcs[0].Confirmed, fcs[0].Coasting)
+			}
+		}
+	}
+}
+
+func TestConfirmReusesTracks(t *testing.T) {
+	c := &confirmer{config: ConfirmConfig{Mode: ConfirmMark, Hits: 2, Window: 3, LostAfter: 2}}
+
+	first := c.apply([]Face{verifiedFace(image.Rect(10, 10, 50, 50))})
+	c.apply(nil)
+	moved := c.apply([]Face{verifiedFace(image.Rect(14, 12, 54, 52))})
+
+	if moved[0].TrackID != first[0].TrackID {
+		t.Errorf("expected track %d to be reused, got %d", first[0].TrackID, moved[0].TrackID)
+	}
+
+	other := c.apply([]Face{verifiedFace(image.Rect(200, 200, 240, 240))})
+	for _, f := range other {
+		if !f.Coasting && f.TrackID == first[0].TrackID {
+			t.Error("expected a face elsewhere in the frame to start a new track")
+		}
+	}
+}
+
+func TestConfirmIgnoresUnverifiedFaces(t *testing.T) {
+	c := &confirmer{config: ConfirmConfig{Mode: ConfirmMark, Hits: 1, Window: 1, LostAfter: 1}}
+
+	fcs := c.apply([]Face{{Rect: image.Rect(10, 10, 50, 50)}})
+	if len(fcs) != 1 || fcs[0].TrackID != 0 || fcs[0].Confirmed {
+		t.Errorf("expected an unverified face to be passed through unconfirmed, got %+v", fcs)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"time"
+
+	messages "github.com/nicholasjackson/drone-messages"
+	"gocv.io/x/gocv"
+)
+
+// MessageTimeToContact is the name of a message with the estimated time until
+// the drone reaches the surface in the centre of the frame
+const MessageTimeToContact = "drone.obstacle.contact"
+
+// expansionSmoothing is the weight given to the latest expansion measurement
+const expansionSmoothing = 0.3
+
+// ContactAction defines the flight command sent when contact is imminent
+type ContactAction string
+
+const (
+	// ContactWarn only publishes the estimate
+	ContactWarn ContactAction = "warn"
+	// ContactHover stops the drone
+	ContactHover ContactAction = "hover"
+	// ContactBackOff moves the drone backwards
+	ContactBackOff ContactAction = "backoff"
+)
+
+// ContactConfig configures the time to contact obstacle warning
+type ContactConfig struct {
+	Action ContactAction
+	// Region is the fraction of the frame width and height, centred in the
+	// frame, in which the expansion is measured
+	Region float64
+	// Threshold is the time to contact below which the action is taken
+	Threshold time.Duration
+	// Speed is the speed of the back off command
+	Speed int
+	// Cooldown is the minimum time between flight commands
+	Cooldown time.Duration
+}
+
+// Validate checks the time to contact settings
+func (c ContactConfig) Validate() error {
+	switch c.Action {
+	case ContactWarn, ContactHover, ContactBackOff:
+	default:
+		return fmt.Errorf("unknown contact action %s, expected warn, hover or backoff", c.Action)
+	}
+
+	if c.Region <= 0 || c.Region > 1 {
+		return fmt.Errorf("contact region must be between 0 and 1")
+	}
+
+	if c.Speed < 1 || c.Speed > maxSpeed {
+		return fmt.Errorf("contact back off speed must be between 1 and %d", maxSpeed)
+	}
+
+	return nil
+}
+
+// TimeToContact is the estimated time until the drone reaches the surface in
+// the centre of the frame
+type TimeToContact struct {
+	// Approaching is false when the surface is not getting closer and
+	// Seconds is not set
+	Approaching bool
+	Seconds     float64
+	// Expansion is the relative rate of approach per second
+	Expansion float64
+	// Warning is true when the time to contact is below the threshold
+	Warning bool
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (tc *TimeToContact) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(tc)
+
+	return b.Bytes()
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (tc *TimeToContact) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(tc)
+}
+
+// ContactEstimator estimates the time to contact from the divergence of the
+// optical flow, a surface approached at a constant speed expands at a rate of
+// one over the time to contact
+type ContactEstimator struct {
+	config ContactConfig
+	flow   opticalFlow
+
+	last      time.Time // time the previous frame was received
+	expansion float64   // smoothed expansion per second
+	commanded time.Time // time the last flight command was sent
+}
+
+// NewContactEstimator creates an estimator for the given settings
+func NewContactEstimator(config ContactConfig) *ContactEstimator {
+	return &ContactEstimator{config: config}
+}
+
+// Estimate measures the expansion between the previous frame and the frame
+// in file received at the given time, nil is returned for the first frame
+func (ce *ContactEstimator) Estimate(file string, received time.Time) (*TimeToContact, error) {
+	img := gocv.IMRead(file, gocv.IMReadColor)
+	defer img.Close()
+
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	mf, ok := ce.flow.next(img)
+	interval := received.Sub(ce.last).Seconds()
+	ce.last = received
+
+	if !ok || interval <= 0 {
+		return nil, nil
+	}
+	defer mf.Close()
+
+	frame := image.Rect(0, 0, img.Cols(), img.Rows())
+	inset := image.Point{
+		X: int(float64(frame.Dx()) * (1 - ce.config.Region) / 2),
+		Y: int(float64(frame.Dy()) * (1 - ce.config.Region) / 2),
+	}
+	central := image.Rectangle{Min: frame.Min.Add(inset), Max: frame.Max.Sub(inset)}
+
+	// divergence is twice the relative rate of approach
+	expansion := mf.divergence(central) / 2 / interval
+	ce.expansion += expansionSmoothing * (expansion - ce.expansion)
+	metricExpansion.Set(ce.expansion)
+
+	tc := &TimeToContact{Expansion: ce.expansion}
+	if ce.expansion > 0 {
+		tc.Approaching = true
+		tc.Seconds = 1 / ce.expansion
+		tc.Warning = tc.Seconds < ce.config.Threshold.Seconds()
+	}
+
+	return tc, nil
+}
+
+// Command returns the flight command for the estimate, nil is returned when
+// no warning has been raised or a command was sent within the cooldown
+func (ce *ContactEstimator) Command(tc *TimeToContact) *messages.Flight {
+	if !tc.Warning || ce.config.Action == ContactWarn || time.Since(ce.commanded) < ce.config.Cooldown {
+		return nil
+	}
+
+	ce.commanded = time.Now()
+	metricContactCommands.Add(1)
+
+	if ce.config.Action == ContactBackOff {
+		return &messages.Flight{Command: CommandBackward, Value: ce.config.Speed}
+	}
+
+	return &messages.Flight{Command: CommandHover}
+}
+
+// Close releases the previous frame
+func (ce *ContactEstimator) Close() {
+	ce.flow.Close()
+}
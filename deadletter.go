@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FailureKind classifies why a frame could not be processed
+type FailureKind string
+
+const (
+	// FailureDecode is a payload which could not be decoded into an image
+	FailureDecode FailureKind = "decode"
+	// FailureImage is image data which could not be read by OpenCV
+	FailureImage FailureKind = "image"
+	// FailureStorage is a frame which could not be written to or read from disk
+	FailureStorage FailureKind = "storage"
+	// FailureDetector is a panic or error raised while detecting faces
+	FailureDetector FailureKind = "detector"
+)
+
+// failureKind classifies an error returned while processing a frame
+func failureKind(err error) FailureKind {
+	switch err.(type) {
+	case *os.PathError:
+		return FailureStorage
+	case jpeg.FormatError, jpeg.UnsupportedError, png.FormatError, png.UnsupportedError:
+		return FailureImage
+	}
+
+	if err == errEmptyImage || err == image.ErrFormat {
+		return FailureImage
+	}
+
+	return FailureDetector
+}
+
+// DeadLetter is a payload which could not be processed along with the reason
+type DeadLetter struct {
+	Kind    FailureKind
+	Error   string
+	Source  string
+	DroneID string
+	Time    time.Time
+	Payload []byte
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (dl *DeadLetter) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(dl)
+
+	return b.Bytes()
+}
+
+// DeadLetterQueue publishes payloads which fail processing to a NATS subject
+// and or saves them to a directory for later inspection
+type DeadLetterQueue struct {
+	subject string
+	dir     string
+}
+
+// NewDeadLetterQueue creates a new dead letter queue, an empty subject or dir
+// disables that destination
+func NewDeadLetterQueue(subject, dir string) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		subject: subject,
+		dir:     dir,
+	}
+}
+
+// Send records the failed payload
+func (d *DeadLetterQueue) Send(kind FailureKind, err error, f *frame) {
+	metricFailures.Add(string(kind), 1)
+	log.Printf("Unable to process frame from %s, %s error: %s", f.Source, kind, err)
+
+	dl := DeadLetter{
+		Kind:    kind,
+		Error:   err.Error(),
+		Source:  f.Source,
+		DroneID: f.DroneID,
+		Time:    time.Now(),
+		Payload: f.Data,
+	}
+
+	// dead letters are signed in the same way as other results
+	if d.subject != "" {
+		publish(d.subject, dl.EncodeMessage())
+	}
+
+	if d.dir != "" {
+		if err := d.save(&dl); err != nil {
+			log.Println("Unable to save dead letter", err)
+		}
+	}
+}
+
+// save writes the payload and a description of the error to the directory
+func (d *DeadLetterQueue) save(dl *DeadLetter) error {
+	name := filepath.Join(d.dir, fmt.Sprintf("%d-%s", dl.Time.UnixNano(), dl.Kind))
+
+	if err := ioutil.WriteFile(name+".payload", dl.Payload, 0644); err != nil {
+		return err
+	}
+
+	info := fmt.Sprintf("kind: %s\nsource: %s\ndrone: %s\ntime: %s\nerror: %s\n",
+		dl.Kind, dl.Source, dl.DroneID, dl.Time.Format(time.RFC3339Nano), dl.Error)
+
+	return ioutil.WriteFile(name+".txt", []byte(info), 0644)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// EvaluatePolicies runs the face processor over fixture images and reports how
+// each verification policy performs. Images in dir/positive contain faces and
+// images in dir/negative do not, recall is the fraction of positive images
+// with a verified face and false positives the number of negative images with
+// a verified face.
+func EvaluatePolicies(fp *FaceProcessor, dir string, policies []VerificationPolicy, out io.Writer) error {
+	positive, err := detectFixtures(fp, filepath.Join(dir, "positive"))
+	if err != nil {
+		return err
+	}
+
+	negative, err := detectFixtures(fp, filepath.Join(dir, "negative"))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "policy\trecall\tfalse positives")
+
+	for _, p := range policies {
+		tp := countVerified(p, positive)
+		falsePos := countVerified(p, negative)
+
+		recall := 0.0
+		if len(positive) > 0 {
+			recall = float64(tp) / float64(len(positive))
+		}
+
+		fmt.Fprintf(tw, "%s\t%.2f\t%d/%d\n", p, recall, falsePos, len(negative))
+	}
+
+	return tw.Flush()
+}
+
+// PolicyCombinations returns every any and all policy for each combination of
+// the given features along with the none policy
+func PolicyCombinations(features []string) []VerificationPolicy {
+	policies := []VerificationPolicy{{Mode: VerifyNone}}
+
+	for mask := 1; mask < 1<<uint(len(features)); mask++ {
+		set := make([]string, 0)
+		for i, f := range features {
+			if mask&(1<<uint(i)) != 0 {
+				set = append(set, f)
+			}
+		}
+
+		policies = append(policies,
+			VerificationPolicy{Mode: VerifyAny, Features: set},
+			VerificationPolicy{Mode: VerifyAll, Features: set},
+		)
+	}
+
+	return policies
+}
+
+// detectFixtures returns the candidate faces for each image in dir
+func detectFixtures(fp *FaceProcessor, dir string) ([][]Face, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]Face, 0)
+	for _, f := range files {
+		// fixtures are unrelated images so must not build up persistence or
+		// be searched around earlier detections
+		fp.previous = nil
+		fp.roi.tracks = nil
+
+		d, err := fp.DetectFaces(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to process fixture %s: %s", f, err)
+		}
+
+		results = append(results, d.Faces)
+	}
+
+	return results, nil
+}
+
+// countVerified returns the number of images which contain a face that passes
+// the policy
+func countVerified(p VerificationPolicy, images [][]Face) int {
+	count := 0
+	for _, faces := range images {
+		for _, f := range faces {
+			if p.Verify(featureCounts(f.Evidence)) {
+				count++
+				break
+			}
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+const fixtureDir = "testdata/evaluate"
+
+// newFixtureProcessor creates a face processor with the default settings,
+// the test is skipped when the OpenCV cascades can not be loaded
+func newFixtureProcessor(t *testing.T) *FaceProcessor {
+	probe := gocv.NewCascadeClassifier()
+	defer probe.Close()
+
+	if !probe.Load("./data/haarcascade_frontalface_default.xml") {
+		t.Skip("OpenCV face cascade is not available")
+	}
+
+	config, err := faceProcessorConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fixtures are unrelated images so the temporal filters are disabled
+	config.Confirm.Mode = ConfirmOff
+	config.Static.Mode = StaticOff
+
+	return NewFaceProcessor(config)
+}
+
+func TestPolicyCombinationsCoversEveryFeatureSet(t *testing.T) {
+	features := []string{FeatureEyes, FeatureGlasses, FeatureNose}
+	policies := PolicyCombinations(features)
+
+	// none plus an any and an all policy for each non empty subset
+	if expected := 1 + 2*(1<<uint(len(features))-1); len(policies) != expected {
+		t.Fatalf("expected %d policies, got %d", expected, len(policies))
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range policies {
+		if seen[p.String()] {
+			t.Errorf("duplicate policy %s", p)
+		}
+
+		seen[p.String()] = true
+	}
+}
+
+func TestEvaluatesEveryPolicyAgainstFixtures(t *testing.T) {
+	fp := newFixtureProcessor(t)
+	policies := PolicyCombinations(fp.AvailableFeatures())
+
+	var out bytes.Buffer
+	if err := EvaluatePolicies(fp, fixtureDir, policies, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(policies)+1 {
+		t.Fatalf("expected a header and %d policies, got:\n%s", len(policies), out.String())
+	}
+
+	for i, p := range policies {
+		if fields := strings.Fields(lines[i+1]); fields[0] != p.String() {
+			t.Errorf("expected policy %s, got %s", p, fields[0])
+		}
+	}
+}
+
+func TestDefaultPolicyOnFixtures(t *testing.T) {
+	fp := newFixtureProcessor(t)
+
+	positive, err := detectFixtures(fp, fixtureDir+"/positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	negative, err := detectFixtures(fp, fixtureDir+"/negative")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countVerified(DefaultVerificationPolicy, positive); n != len(positive) {
+		t.Errorf("expected a verified face in all %d positive fixtures, got %d", len(positive), n)
+	}
+
+	// the negative fixtures are textures which the face cascade mistakes for
+	// faces, so the none policy accepts each of them
+	none := countVerified(VerificationPolicy{Mode: VerifyNone}, negative)
+	if none != len(negative) {
+		t.Fatalf("expected the cascade to find a face in all %d negative fixtures, got %d", len(negative), none)
+	}
+
+	if n := countVerified(DefaultVerificationPolicy, negative); n >= none {
+		t.Errorf("expected %s to reject negative fixtures accepted without verification, got %d of %d", DefaultVerificationPolicy, n, none)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import "image"
+
+// Orientation is an estimate of the direction a face is turned
+type Orientation string
+
+const (
+	// OrientationFrontal is a face looking towards the camera
+	OrientationFrontal Orientation = "frontal"
+	// OrientationLeft is a face turned towards the left of the image
+	OrientationLeft Orientation = "left"
+	// OrientationRight is a face turned towards the right of the image
+	OrientationRight Orientation = "right"
+)
+
+// Face is a detected face along with the evidence used to verify it
+type Face struct {
+	// Rect is the axis aligned bounds of the face in frame coordinates
+	Rect image.Rectangle
+	// Rotation is the angle in degrees the frame was rotated by when the face
+	// was found, Corners holds the rotated box of the face in frame coordinates
+	// and is nil when the face was found in the upright frame
+	Rotation float64
+	Corners  []image.Point
+	// Orientation estimates the direction the face is turned
+	Orientation Orientation
+	// Static is true when the face has not moved relative to the scene for
+	// several frames and is likely a poster, photograph or screen
+	Static bool
+	// TrackID identifies the same verified face across frames and Confirmed
+	// is true once it has been seen in enough recent frames, both are only set
+	// when temporal confirmation is enabled
+	TrackID   int
+	Confirmed bool
+	// Coasting is true when a confirmed face was not found in this frame, the
+	// face is reported at its last position until it is lost
+	Coasting bool
+	// Confidence is a score between 0 and 1 built from the evidence
+	Confidence float64
+	// Verified is true when the face passed the detectors verification rule
+	Verified bool
+	// VerificationSkipped is true when the face was not searched for features
+	// because the latency budget was exceeded, such faces are not Verified but
+	// are accepted in the same way
+	VerificationSkipped bool
+	Evidence            FaceEvidence
+	// EyeCentres are the centres of all eyes found, in frame coordinates
+	EyeCentres []image.Point
+	// Landmarks are calculated from the most plausible pair of eyes and are
+	// nil when no pair was found
+	Landmarks *EyeLandmarks
+}
+
+// Accepted returns true when the face is verified or was accepted without
+// verification because the latency budget was exceeded
+func (f Face) Accepted() bool {
+	return f.Verified || f.VerificationSkipped
+}
+
+// FaceEvidence holds the features which were found within a face, all
+// rectangles are in frame coordinates
+type FaceEvidence struct {
+	Eyes    []image.Rectangle
+	Glasses []image.Rectangle
+	Nose    []image.Rectangle
+	Mouth   []image.Rectangle
+	Smile   []image.Rectangle
+	// Neighbours is the number of raw cascade detections grouped into this
+	// face, a face needs at least minNeighbours
+	Neighbours int
+	// Persistence is the number of consecutive frames the face has been seen
+	Persistence int
+}
+
+// score weights for the confidence of a face, the weights sum to 1
+const (
+	weightEyes        = 0.35
+	weightEyePosition = 0.1
+	weightGlasses     = 0.15
+	weightNeighbours  = 0.2
+	weightPersistence = 0.2
+)
+
+// scoreFace calculates the confidence for a face from its evidence
+func scoreFace(f *Face) float64 {
+	e := f.Evidence
+	score := weightEyes * float64(minInt(len(e.Eyes), 2)) / 2
+
+	if f.Landmarks != nil {
+		score += weightEyePosition
+	}
+
+	if len(e.Glasses) > 0 {
+		score += weightGlasses
+	}
+
+	score += weightNeighbours * float64(minInt(e.Neighbours, 10)) / 10
+	score += weightPersistence * float64(minInt(e.Persistence, 5)) / 5
+
+	return score
+}
+
+// persistence returns the number of consecutive frames a face has been seen
+// by matching it against the faces found in the previous frame
+func persistence(r image.Rectangle, previous []Face) int {
+	best, count := 0.3, 0
+	for _, p := range previous {
+		if iou := IoU(r, p.Rect); iou >= best {
+			best, count = iou, p.Evidence.Persistence
+		}
+	}
+
+	return count + 1
+}
+
+func center(r image.Rectangle) image.Point {
+	return image.Point{X: (r.Min.X + r.Max.X) / 2, Y: (r.Min.Y + r.Max.Y) / 2}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
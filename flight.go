@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+
+	messages "github.com/nicholasjackson/drone-messages"
+)
+
+// movement commands understood by the drone service in addition to the
+// takeoff and land commands defined by the messages package, the Value of a
+// movement command is a speed from 0 to 100 and 0 stops movement on that axis
+const (
+	CommandLeft             = "left"
+	CommandRight            = "right"
+	CommandForward          = "forward"
+	CommandBackward         = "backward"
+	CommandUp               = "up"
+	CommandDown             = "down"
+	CommandClockwise        = "clockwise"
+	CommandCounterClockwise = "counterclockwise"
+	CommandHover            = "hover"
+)
+
+// maxSpeed is the largest Value of a movement command
+const maxSpeed = 100
+
+// publishFlight sends a flight command to the drone
+func publishFlight(f messages.Flight) {
+	publish(messages.MessageFlight, f.EncodeMessage())
+}
+
+// axisCommand returns the movement command correcting the error e along one
+// axis, negative errors are corrected with the negative command, the speed is
+// proportional to the error and is 0 when the error is within tolerance
+func axisCommand(e, tolerance, gain float64, speed int, negative, positive string) messages.Flight {
+	command := positive
+	if e < 0 {
+		command = negative
+	}
+
+	if math.Abs(e) <= tolerance {
+		return messages.Flight{Command: command}
+	}
+
+	v := int(math.Abs(e) * gain)
+	if v > speed {
+		v = speed
+	}
+
+	return messages.Flight{Command: command, Value: maxInt(v, 1)}
+}
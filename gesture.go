@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+	messages "github.com/nicholasjackson/drone-messages"
+	"gocv.io/x/gocv"
+)
+
+// MessageGestureEnable is the name of a message which arms or disarms gesture
+// commands at runtime, the payload is true or false
+const MessageGestureEnable = "drone.gestures.enable"
+
+// CommandFollow instructs the drone to follow the person who made the gesture
+const CommandFollow = "follow"
+
+// Gesture is a hand shape held in a position relative to a face
+type Gesture string
+
+const (
+	// GestureNone is returned when no gesture is recognised
+	GestureNone Gesture = ""
+	// GesturePalmRaised is an open palm held above the face
+	GesturePalmRaised Gesture = "palm-raised"
+	// GestureFistRaised is a fist held above the face
+	GestureFistRaised Gesture = "fist-raised"
+	// GesturePalmBeside is an open palm held beside the face
+	GesturePalmBeside Gesture = "palm-beside"
+)
+
+// gestureCommands maps each gesture to the flight command it sends
+var gestureCommands = map[Gesture]string{
+	GesturePalmRaised: messages.CommandLand,
+	GestureFistRaised: messages.CommandTakeOff,
+	GesturePalmBeside: CommandFollow,
+}
+
+// GestureConfig configures the gesture commands
+type GestureConfig struct {
+	// Enabled arms gesture commands when the service starts, commands are
+	// never sent while disarmed
+	Enabled     bool
+	PalmCascade string
+	FistCascade string
+	// Hold is how long a gesture must be seen before its command is sent
+	Hold time.Duration
+}
+
+// Validate checks the gesture settings
+func (c GestureConfig) Validate() error {
+	if c.PalmCascade == "" || c.FistCascade == "" {
+		return fmt.Errorf("gestures require a palm and a fist cascade")
+	}
+
+	if c.Hold <= 0 {
+		return fmt.Errorf("gesture hold time must be greater than 0")
+	}
+
+	return nil
+}
+
+// GestureDetector recognises hand gestures made by people with a confirmed
+// face and turns gestures which are held into flight commands
+type GestureDetector struct {
+	config GestureConfig
+	palm   *gocv.CascadeClassifier
+	fist   *gocv.CascadeClassifier
+
+	mutex sync.Mutex
+	armed bool
+
+	gesture Gesture   // gesture seen in the last frame
+	since   time.Time // time the gesture was first seen
+	sent    bool      // true when the command for the gesture has been sent
+}
+
+// NewGestureDetector loads the hand cascades
+func NewGestureDetector(config GestureConfig) (*GestureDetector, error) {
+	palm := loadOptionalClassifier(config.PalmCascade)
+	if palm == nil {
+		return nil, fmt.Errorf("unable to load palm cascade %s", config.PalmCascade)
+	}
+
+	fist := loadOptionalClassifier(config.FistCascade)
+	if fist == nil {
+		palm.Close()
+		return nil, fmt.Errorf("unable to load fist cascade %s", config.FistCascade)
+	}
+
+	return &GestureDetector{
+		config: config,
+		palm:   palm,
+		fist:   fist,
+		armed:  config.Enabled,
+	}, nil
+}
+
+// HandleEnable arms or disarms the gesture commands, the commands can only be
+// armed by a message signed with a known key, any message can disarm them
+func (g *GestureDetector) HandleEnable(m *nats.Msg) {
+	data, err := verifySigned(m)
+	if err == errUnsigned {
+		data = m.Data
+	} else if err != nil {
+		log.Println("Rejected gesture enable message", err)
+		return
+	}
+
+	armed, perr := strconv.ParseBool(string(data))
+	if perr != nil {
+		log.Println("Invalid gesture enable message", perr)
+		return
+	}
+
+	if armed && err != nil {
+		log.Println("Rejected gesture enable message, arming requires a signed message")
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.armed = armed
+	g.gesture = GestureNone
+	log.Println("Gesture commands armed", armed)
+}
+
+// Detect searches around each confirmed face for a gesture, a command is
+// returned once when a gesture has been held for the hold time
+func (g *GestureDetector) Detect(file string, faces []Face) (*messages.Flight, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.armed {
+		return nil, nil
+	}
+
+	img := gocv.IMRead(file, gocv.IMReadColor)
+	defer img.Close()
+
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	gesture := GestureNone
+	for _, f := range faces {
+		// gestures are only read from verified faces found in this frame
+		if f.Confirmed && !f.Coasting && f.Verified {
+			if gesture = g.recognise(img, f.Rect); gesture != GestureNone {
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	if gesture != g.gesture {
+		g.gesture = gesture
+		g.since = now
+		g.sent = false
+	}
+
+	if gesture == GestureNone || g.sent || now.Sub(g.since) < g.config.Hold {
+		return nil, nil
+	}
+
+	g.sent = true
+	metricGestures.Add(string(gesture), 1)
+
+	return &messages.Flight{Command: gestureCommands[gesture]}, nil
+}
+
+// recognise searches the area around a face for palms and fists and applies
+// the positional rules, an open palm takes priority over a fist
+func (g *GestureDetector) recognise(img gocv.Mat, face image.Rectangle) Gesture {
+	w, h := face.Dx(), face.Dy()
+
+	// hands are searched for up to two face heights above and three face
+	// widths either side of the face
+	search := image.Rect(face.Min.X-3*w, face.Min.Y-2*h, face.Max.X+3*w, face.Max.Y).
+		Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if search.Empty() {
+		return GestureNone
+	}
+
+	region := img.Region(search)
+	defer region.Close()
+
+	minSize := image.Point{X: w / 2, Y: h / 2}
+	maxSize := image.Point{X: w * 2, Y: h * 2}
+
+	for _, r := range g.palm.DetectMultiScaleWithParams(region, 1.1, 3, 0, minSize, maxSize) {
+		hand := r.Add(search.Min)
+		switch {
+		case handRaised(face, hand):
+			return GesturePalmRaised
+		case handBeside(face, hand):
+			return GesturePalmBeside
+		}
+	}
+
+	for _, r := range g.fist.DetectMultiScaleWithParams(region, 1.1, 3, 0, minSize, maxSize) {
+		if handRaised(face, r.Add(search.Min)) {
+			return GestureFistRaised
+		}
+	}
+
+	return GestureNone
+}
+
+// handRaised is true when the hand is above the face and within two face
+// widths of it horizontally
+func handRaised(face, hand image.Rectangle) bool {
+	c := center(hand)
+	return c.Y < face.Min.Y && absInt(c.X-center(face).X) <= 2*face.Dx()
+}
+
+// handBeside is true when the hand is level with the face and does not
+// overlap it
+func handBeside(face, hand image.Rectangle) bool {
+	c := center(hand)
+	return c.Y >= face.Min.Y && c.Y <= face.Max.Y && !hand.Overlaps(face)
+}
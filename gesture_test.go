@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nats-io/nats"
+)
+
+func TestGesturesAreNotArmedByUnsignedMessage(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	keyring = k
+	defer func() { keyring = nil }()
+
+	g := &GestureDetector{}
+	g.HandleEnable(&nats.Msg{Subject: MessageGestureEnable, Data: []byte("true")})
+	if g.armed {
+		t.Fatal("expected unsigned message not to arm gestures")
+	}
+
+	g.HandleEnable(&nats.Msg{Subject: MessageGestureEnable, Data: k.Sign(MessageGestureEnable, []byte("true"))})
+	if !g.armed {
+		t.Fatal("expected signed message to arm gestures")
+	}
+
+	g.HandleEnable(&nats.Msg{Subject: MessageGestureEnable, Data: []byte("false")})
+	if g.armed {
+		t.Fatal("expected unsigned message to disarm gestures")
+	}
+}
+
+func TestGesturesAreNotArmedWithoutKeys(t *testing.T) {
+	g := &GestureDetector{}
+	g.HandleEnable(&nats.Msg{Subject: MessageGestureEnable, Data: []byte("true")})
+	if g.armed {
+		t.Fatal("expected gestures not to be armed without keys")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IngestHandler accepts frames pushed over HTTP for cameras which are unable
+// to publish to NATS, frames are posted to /ingest/<droneID> as a jpeg or png,
+// optionally gzipped, and are added to the same queue as frames received from NATS.
+// The service tracks a single drone so frames for any other drone are rejected
+type IngestHandler struct {
+	token   string
+	maxSize int64
+	droneID string
+	queue   *FrameQueue
+}
+
+// NewIngestHandler creates a new handler which requires requests to present
+// token as a bearer token and accepts frames for droneID
+func NewIngestHandler(token string, maxSize int64, droneID string, queue *FrameQueue) *IngestHandler {
+	return &IngestHandler{
+		token:   token,
+		maxSize: maxSize,
+		droneID: droneID,
+		queue:   queue,
+	}
+}
+
+func (h *IngestHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authorized(r) {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	droneID := strings.TrimPrefix(r.URL.Path, "/ingest/")
+	if droneID == "" || strings.Contains(droneID, "/") {
+		http.Error(rw, "expected /ingest/<droneID>", http.StatusNotFound)
+		return
+	}
+
+	if droneID != h.droneID {
+		http.Error(rw, "unknown drone "+droneID, http.StatusNotFound)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, h.maxSize))
+	if err != nil {
+		http.Error(rw, "unable to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err = decodeImageData(data)
+	if err == errUnknownImage {
+		http.Error(rw, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metricFramesReceived.Add(1)
+
+	f := &frame{DroneID: droneID, Source: "http", Data: data, Received: time.Now()}
+	if err := h.queue.Enqueue(f); err == errQueueFull {
+		metricFramesDropped.Add(1)
+		rw.Header().Set("Retry-After", "1")
+		http.Error(rw, "frame queue is full", http.StatusTooManyRequests)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func (h *IngestHandler) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+	messages "github.com/nicholasjackson/drone-messages"
+	"gocv.io/x/gocv"
+)
+
+// MessageLandingPad is the name of a message when a landing pad has been
+// found by the downward camera
+const MessageLandingPad = "image.landingpad"
+
+// houghGradient is the cv::HOUGH_GRADIENT method, gocv does not export it
+const houghGradient = 3
+
+// LandingMode defines how landing pads are used
+type LandingMode string
+
+const (
+	// LandingOff disables the landing pad detector
+	LandingOff LandingMode = "off"
+	// LandingDetect publishes the position of landing pads
+	LandingDetect LandingMode = "detect"
+	// LandingGuide also issues flight corrections while the drone is landing
+	LandingGuide LandingMode = "guide"
+)
+
+// LandingConfig configures the landing pad detector
+type LandingConfig struct {
+	Mode LandingMode
+	// MinRadius is the smallest apparent radius of a pad in pixels
+	MinRadius int
+	// Tolerance is the offset, as a fraction of half the frame, within which
+	// the pad is considered centred
+	Tolerance float64
+	// Gain is the speed for an offset of half the frame
+	Gain float64
+	// MaxSpeed limits the speed of a correction
+	MaxSpeed int
+	// Timeout is how long corrections are issued after a land command
+	Timeout time.Duration
+}
+
+// Validate checks the landing settings
+func (c LandingConfig) Validate() error {
+	switch c.Mode {
+	case LandingOff, LandingDetect, LandingGuide:
+	default:
+		return fmt.Errorf("unknown landing mode %s, expected off, detect or guide", c.Mode)
+	}
+
+	if c.MaxSpeed < 1 || c.MaxSpeed > maxSpeed {
+		return fmt.Errorf("landing max speed must be between 1 and %d", maxSpeed)
+	}
+
+	if c.MinRadius < 1 {
+		return fmt.Errorf("landing min radius must be at least 1 pixel")
+	}
+
+	if c.Tolerance < 0 || c.Tolerance >= 1 {
+		return fmt.Errorf("landing tolerance must be between 0 and 1")
+	}
+
+	if c.Gain <= 0 {
+		return fmt.Errorf("landing gain must be greater than 0")
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("landing timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+// LandingPad defines the position of a landing pad in a frame
+type LandingPad struct {
+	Found  bool
+	Center image.Point
+	// Offset is the position of the centre relative to the centre of the
+	// frame, positive values are to the right of and below the centre
+	Offset image.Point
+	Radius int
+	// Rings is the number of concentric rings found, a plain circle has one
+	Rings  int
+	Bounds image.Rectangle
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (lp *LandingPad) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(lp)
+
+	return b.Bytes()
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (lp *LandingPad) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(lp)
+}
+
+// circle is a circle found in a frame
+type circle struct {
+	center image.Point
+	radius int
+}
+
+// DetectLandingPad finds the circular or concentric ring landing pad in the
+// image, circles found by the Hough transform and circular contours are both
+// candidates and the candidate with the most concentric rings is chosen
+func DetectLandingPad(file string, minRadius int) (*LandingPad, error) {
+	img := gocv.IMRead(file, gocv.IMReadGrayScale)
+	defer img.Close()
+
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	pad := &LandingPad{Bounds: bounds}
+
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.MedianBlur(img, blurred, 5)
+
+	contours := contourCircles(blurred, minRadius)
+	candidates := append(houghCircles(blurred, minRadius), contours...)
+
+	best := circle{}
+	for _, c := range candidates {
+		rings := concentricRings(c, contours)
+		if rings > pad.Rings || (rings == pad.Rings && c.radius > best.radius) {
+			best = c
+			pad.Rings = rings
+		}
+	}
+
+	if best.radius == 0 {
+		return pad, nil
+	}
+
+	metricLandingPads.Add(1)
+
+	pad.Found = true
+	pad.Center = best.center
+	pad.Radius = best.radius
+	pad.Offset = best.center.Sub(center(bounds))
+	pad.Rings = maxInt(pad.Rings, 1)
+
+	return pad, nil
+}
+
+// houghCircles returns the circles found by the Hough transform
+func houghCircles(gray gocv.Mat, minRadius int) []circle {
+	circles := gocv.NewMat()
+	defer circles.Close()
+
+	gocv.HoughCircles(gray, circles, houghGradient, 1, float64(gray.Rows())/8)
+
+	found := make([]circle, 0)
+	if circles.Empty() {
+		return found
+	}
+
+	// each circle is stored as three floats, x, y and radius
+	for i := 0; i < circles.Cols(); i++ {
+		c := circle{
+			center: image.Point{
+				X: int(circles.GetFloatAt(0, i*3)),
+				Y: int(circles.GetFloatAt(0, i*3+1)),
+			},
+			radius: int(circles.GetFloatAt(0, i*3+2)),
+		}
+
+		if c.radius >= minRadius {
+			found = append(found, c)
+		}
+	}
+
+	return found
+}
+
+// contourCircles returns the edge contours which are close to circular, the
+// Hough transform only finds one of a set of concentric circles so contours
+// are used to count the rings
+func contourCircles(gray gocv.Mat, minRadius int) []circle {
+	edges := gocv.NewMat()
+	defer edges.Close()
+
+	gocv.Canny(gray, edges, 50, 150)
+
+	found := make([]circle, 0)
+	for _, c := range gocv.FindContours(edges, gocv.RetrievalList, gocv.ChainApproxSimple) {
+		r := gocv.BoundingRect(c)
+		radius := (r.Dx() + r.Dy()) / 4
+		if radius < minRadius || r.Dx() < r.Dy()*4/5 || r.Dy() < r.Dx()*4/5 {
+			continue
+		}
+
+		// the area of a circle filling its bounding box
+		fill := gocv.ContourArea(c) / (math.Pi * float64(radius*radius))
+		if fill < 0.8 || fill > 1.2 {
+			continue
+		}
+
+		found = append(found, circle{center: center(r), radius: radius})
+	}
+
+	return found
+}
+
+// concentricRings counts the circles sharing the centre of c, both edges of
+// a ring are found so circles with a similar radius are counted once
+func concentricRings(c circle, circles []circle) int {
+	radii := make([]int, 0)
+	for _, o := range circles {
+		d := o.center.Sub(c.center)
+		if absInt(d.X) > maxInt(c.radius/4, 3) || absInt(d.Y) > maxInt(c.radius/4, 3) || o.radius > c.radius*11/10 {
+			continue
+		}
+
+		distinct := true
+		for _, r := range radii {
+			if absInt(o.radius-r) < maxInt(r*15/100, 2) {
+				distinct = false
+				break
+			}
+		}
+
+		if distinct {
+			radii = append(radii, o.radius)
+		}
+	}
+
+	return len(radii)
+}
+
+// LandingGuider issues flight corrections which centre the drone over the
+// landing pad while it is landing
+type LandingGuider struct {
+	config LandingConfig
+
+	mutex     sync.Mutex
+	landing   time.Time // time the last land command was seen
+	centering bool      // true when a correction has been sent
+}
+
+// NewLandingGuider creates a guider for the given settings
+func NewLandingGuider(config LandingConfig) *LandingGuider {
+	return &LandingGuider{config: config}
+}
+
+// HandleFlight watches the flight commands sent to the drone for land and
+// takeoff
+func (g *LandingGuider) HandleFlight(m *nats.Msg) {
+	data, ok := verifyCommand(m)
+	if !ok {
+		return
+	}
+
+	f := messages.Flight{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&f); err != nil {
+		log.Println("Unable to decode flight message", err)
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	switch f.Command {
+	case messages.CommandLand:
+		g.landing = time.Now()
+	case messages.CommandTakeOff:
+		g.landing = time.Time{}
+	}
+}
+
+// Correct returns the flight commands which move the drone towards the pad,
+// no commands are returned unless the drone is landing, when the pad is lost
+// the drone is stopped once
+func (g *LandingGuider) Correct(pad *LandingPad) []messages.Flight {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.landing.IsZero() || time.Since(g.landing) > g.config.Timeout {
+		return nil
+	}
+
+	if !pad.Found {
+		if !g.centering {
+			return nil
+		}
+
+		g.centering = false
+		return []messages.Flight{{Command: CommandHover}}
+	}
+
+	g.centering = true
+
+	// the top of a downward camera frame faces the front of the drone
+	half := center(pad.Bounds)
+	x := float64(pad.Offset.X) / float64(half.X)
+	y := float64(pad.Offset.Y) / float64(half.Y)
+
+	return []messages.Flight{
+		axisCommand(x, g.config.Tolerance, g.config.Gain, g.config.MaxSpeed, CommandLeft, CommandRight),
+		axisCommand(y, g.config.Tolerance, g.config.Gain, g.config.MaxSpeed, CommandForward, CommandBackward),
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// EyeLandmarks describes the position of a pair of eyes within the frame
+type EyeLandmarks struct {
+	// Left and Right are the centres of the eyes on the left and right of the
+	// image, in frame coordinates
+	Left  image.Point
+	Right image.Point
+	// InterOcular is the distance in pixels between the eye centres
+	InterOcular float64
+	// Roll is the in plane rotation of the face in degrees, positive when the
+	// right eye is lower than the left
+	Roll float64
+}
+
+// eyeCentres returns the centre of each eye rectangle
+func eyeCentres(eyes []image.Rectangle) []image.Point {
+	centres := make([]image.Point, len(eyes))
+	for i, e := range eyes {
+		centres[i] = center(e)
+	}
+
+	return centres
+}
+
+// findEyeLandmarks chooses the most plausible pair of eyes within the face
+// and returns their landmarks, nil is returned when no pair is plausible
+func findEyeLandmarks(face image.Rectangle, eyes []image.Rectangle) *EyeLandmarks {
+	var best *EyeLandmarks
+	var bestArea float64
+
+	for i := 0; i < len(eyes); i++ {
+		for j := i + 1; j < len(eyes); j++ {
+			a, b := center(eyes[i]), center(eyes[j])
+			if !eyePairPlausible(face, a, b) {
+				continue
+			}
+
+			// prefer the largest pair as small detections are often noise
+			if pa := area(eyes[i]) + area(eyes[j]); best == nil || pa > bestArea {
+				best, bestArea = newEyeLandmarks(a, b), pa
+			}
+		}
+	}
+
+	return best
+}
+
+func newEyeLandmarks(a, b image.Point) *EyeLandmarks {
+	if b.X < a.X {
+		a, b = b, a
+	}
+
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+
+	return &EyeLandmarks{
+		Left:        a,
+		Right:       b,
+		InterOcular: math.Hypot(dx, dy),
+		Roll:        math.Atan2(dy, dx) * 180 / math.Pi,
+	}
+}
+
+// eyePairPlausible returns true when two eye centres sit side by side in the
+// upper part of the face
+func eyePairPlausible(face image.Rectangle, a, b image.Point) bool {
+	upper := face.Min.Y + face.Dy()*6/10
+	if a.Y > upper || b.Y > upper {
+		return false
+	}
+
+	dx, dy := absInt(a.X-b.X), absInt(a.Y-b.Y)
+	return dx > face.Dx()/5 && dy < face.Dy()/5
+}
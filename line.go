@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"math"
+
+	messages "github.com/nicholasjackson/drone-messages"
+	"gocv.io/x/gocv"
+)
+
+// MessageLine is the name of a message with the position of the line being
+// followed by the downward camera
+const MessageLine = "image.line"
+
+// lineBins is the number of angle bins used to find the dominant direction
+const lineBins = 18
+
+// LineMode defines how the line detector is used
+type LineMode string
+
+const (
+	// LineOff disables the line detector
+	LineOff LineMode = "off"
+	// LineDetect publishes the angle and offset of the line
+	LineDetect LineMode = "detect"
+	// LineFollow also issues yaw and lateral flight commands to follow it
+	LineFollow LineMode = "follow"
+)
+
+// LineConfig configures the line detector and controller
+type LineConfig struct {
+	Mode LineMode
+	// Votes is the Hough accumulator threshold for a segment
+	Votes int
+	// MinLength is the smallest total length in pixels of the dominant line
+	MinLength float64
+	// AngleTolerance in degrees and OffsetTolerance as a fraction of half the
+	// frame width are the errors which are not corrected
+	AngleTolerance  float64
+	OffsetTolerance float64
+	// YawGain is the yaw speed for an angle of 90 degrees and LateralGain
+	// the lateral speed for an offset of half the frame
+	YawGain     float64
+	LateralGain float64
+	MaxSpeed    int
+}
+
+// Validate checks the line settings
+func (c LineConfig) Validate() error {
+	switch c.Mode {
+	case LineOff, LineDetect, LineFollow:
+	default:
+		return fmt.Errorf("unknown line mode %s, expected off, detect or follow", c.Mode)
+	}
+
+	if c.Votes < 1 {
+		return fmt.Errorf("line votes must be at least 1")
+	}
+
+	if c.MaxSpeed < 1 || c.MaxSpeed > maxSpeed {
+		return fmt.Errorf("line max speed must be between 1 and %d", maxSpeed)
+	}
+
+	return nil
+}
+
+// LineResult is the position of the dominant line in a frame
+type LineResult struct {
+	Found bool
+	// Angle is the direction of the line in degrees from the top of the
+	// frame, positive when the line leans to the right
+	Angle float64
+	// Offset is the distance of the line from the centre of the frame, where
+	// it crosses the middle row, as a fraction of half the frame width,
+	// positive when the line is to the right
+	Offset float64
+	// Start and End are the ends of the line within the frame
+	Start  image.Point
+	End    image.Point
+	Bounds image.Rectangle
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (lr *LineResult) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(lr)
+
+	return b.Bytes()
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (lr *LineResult) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(lr)
+}
+
+// LineFollower finds the dominant line in frames from the downward camera
+// and turns its position into flight commands
+type LineFollower struct {
+	config    LineConfig
+	following bool // true when a command has been sent for a line
+}
+
+// NewLineFollower creates a follower for the given settings
+func NewLineFollower(config LineConfig) *LineFollower {
+	return &LineFollower{config: config}
+}
+
+// Detect finds the dominant line in the image, the segments found by the
+// Hough transform are grouped by angle and the group with the greatest total
+// length is the line
+func (lf *LineFollower) Detect(file string) (*LineResult, error) {
+	img := gocv.IMRead(file, gocv.IMReadGrayScale)
+	defer img.Close()
+
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	lr := &LineResult{Bounds: bounds}
+
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.GaussianBlur(img, blurred, image.Point{X: 5, Y: 5}, 0, 0, gocv.BorderDefault)
+
+	edges := gocv.NewMat()
+	defer edges.Close()
+	gocv.Canny(blurred, edges, 50, 150)
+
+	lines := gocv.NewMat()
+	defer lines.Close()
+	gocv.HoughLinesP(edges, lines, 1, math.Pi/180, lf.config.Votes)
+
+	// the length, doubled angle vector and midpoint sums of each angle bin,
+	// doubling the angle makes opposite directions of a segment agree
+	type bin struct {
+		length, cos, sin, x, y float64
+	}
+	bins := make([]bin, lineBins)
+
+	for i := 0; i < lines.Rows(); i++ {
+		x1, y1 := float64(lines.GetIntAt(i, 0)), float64(lines.GetIntAt(i, 1))
+		x2, y2 := float64(lines.GetIntAt(i, 2)), float64(lines.GetIntAt(i, 3))
+
+		length := math.Hypot(x2-x1, y2-y1)
+		if length == 0 {
+			continue
+		}
+
+		// angle from the top of the frame between -90 and 90 degrees
+		theta := math.Atan2(x2-x1, y1-y2)
+		if theta > math.Pi/2 {
+			theta -= math.Pi
+		} else if theta <= -math.Pi/2 {
+			theta += math.Pi
+		}
+
+		b := &bins[int((theta+math.Pi/2)/math.Pi*lineBins)%lineBins]
+		b.length += length
+		b.cos += length * math.Cos(2*theta)
+		b.sin += length * math.Sin(2*theta)
+		b.x += length * (x1 + x2) / 2
+		b.y += length * (y1 + y2) / 2
+	}
+
+	best := bin{}
+	for _, b := range bins {
+		if b.length > best.length {
+			best = b
+		}
+	}
+
+	if best.length < lf.config.MinLength || best.length == 0 {
+		return lr, nil
+	}
+
+	theta := math.Atan2(best.sin, best.cos) / 2
+	mid := image.Point{X: int(best.x / best.length), Y: int(best.y / best.length)}
+	c := center(bounds)
+
+	lr.Found = true
+	lr.Angle = theta * 180 / math.Pi
+
+	// the line leans right by tan(theta) pixels for each pixel upwards, it is
+	// limited so that a line across the frame does not overflow
+	lean := math.Max(-float64(bounds.Dx()), math.Min(float64(bounds.Dx()), math.Tan(theta)))
+	x := float64(mid.X) + float64(mid.Y-c.Y)*lean
+	lr.Offset = (x - float64(c.X)) / float64(c.X)
+
+	// extend the line to the top and bottom of the frame
+	lr.Start = image.Point{X: int(x + float64(c.Y)*lean), Y: bounds.Min.Y}
+	lr.End = image.Point{X: int(x - float64(c.Y)*lean), Y: bounds.Max.Y}
+
+	metricLinesFound.Add(1)
+
+	return lr, nil
+}
+
+// Command returns the yaw and lateral commands which turn the drone along the
+// line and move it over the line, when the line is lost the drone is stopped
+// once
+func (lf *LineFollower) Command(lr *LineResult) []messages.Flight {
+	if lf.config.Mode != LineFollow {
+		return nil
+	}
+
+	if !lr.Found {
+		if !lf.following {
+			return nil
+		}
+
+		lf.following = false
+		return []messages.Flight{{Command: CommandHover}}
+	}
+
+	lf.following = true
+
+	return []messages.Flight{
+		axisCommand(lr.Angle/90, lf.config.AngleTolerance/90, lf.config.YawGain, lf.config.MaxSpeed, CommandCounterClockwise, CommandClockwise),
+		axisCommand(lr.Offset, lf.config.OffsetTolerance, lf.config.LateralGain, lf.config.MaxSpeed, CommandLeft, CommandRight),
+	}
+}
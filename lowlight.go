@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// LowLightMode defines when the low light enhancement profile is applied
+type LowLightMode string
+
+const (
+	// LowLightOff never enhances frames
+	LowLightOff LowLightMode = "off"
+	// LowLightAuto enhances frames which are darker than the threshold
+	LowLightAuto LowLightMode = "auto"
+	// LowLightOn enhances every frame
+	LowLightOn LowLightMode = "on"
+)
+
+// LowLightConfig configures preprocessing for dark and noisy frames
+type LowLightConfig struct {
+	Mode LowLightMode
+	// Threshold is the mean brightness, 0 to 255, below which frames are
+	// enhanced in auto mode
+	Threshold float64
+	// Gamma brightens the mid tones when greater than 1
+	Gamma float64
+	// Denoise is the filter used to remove noise: none, median or bilateral
+	Denoise string
+	// InvertIR inverts frames from thermal cameras which render warm objects
+	// dark so that faces appear as they would in visible light
+	InvertIR bool
+}
+
+// Validate checks the low light settings
+func (c LowLightConfig) Validate() error {
+	switch c.Mode {
+	case LowLightOff, LowLightAuto, LowLightOn:
+	default:
+		return fmt.Errorf("unknown low light mode %s, expected off, auto or on", c.Mode)
+	}
+
+	switch c.Denoise {
+	case "none", "median", "bilateral":
+	default:
+		return fmt.Errorf("unknown denoise filter %s, expected none, median or bilateral", c.Denoise)
+	}
+
+	if c.Gamma <= 0 {
+		return fmt.Errorf("gamma must be greater than 0")
+	}
+
+	return nil
+}
+
+// preprocess inverts IR frames and applies the low light profile when
+// required, the returned Mat replaces img and enhanced reports if the low
+// light profile was applied
+func (c LowLightConfig) preprocess(img gocv.Mat) (out gocv.Mat, enhanced bool, err error) {
+	if c.InvertIR {
+		gocv.BitwiseNot(img, img)
+	}
+
+	if !c.required(img) {
+		return img, false, nil
+	}
+
+	metricLowLightFrames.Add(1)
+
+	// the gocv bindings have no histogram equalization or lookup tables so the
+	// tone mapping is applied to a Go image of the inverted frame
+	src, err := matImage(img)
+	if err != nil {
+		return img, false, err
+	}
+
+	rgba := toRGBA(src)
+	equalize(rgba, c.Gamma)
+
+	out, err = toMat(rgba)
+	if err != nil {
+		return img, false, err
+	}
+
+	switch c.Denoise {
+	case "median":
+		gocv.MedianBlur(out, out, 3)
+	case "bilateral":
+		denoised := gocv.NewMat()
+		gocv.BilateralFilter(out, denoised, 9, 50, 50)
+		out.Close()
+		out = denoised
+	}
+
+	return out, true, nil
+}
+
+// required returns true when the frame should be enhanced
+func (c LowLightConfig) required(img gocv.Mat) bool {
+	switch c.Mode {
+	case LowLightOn:
+		return true
+	case LowLightAuto:
+		m := img.Mean()
+		return (m.Val1+m.Val2+m.Val3)/3 < c.Threshold
+	}
+
+	return false
+}
+
+// equalize equalizes the histogram of the luminance of img and applies gamma
+// correction, the colour channels are scaled to preserve the hue
+func equalize(img *image.RGBA, gamma float64) {
+	var hist [256]int
+	lum := func(i int) int {
+		return (299*int(img.Pix[i]) + 587*int(img.Pix[i+1]) + 114*int(img.Pix[i+2])) / 1000
+	}
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		hist[lum(i)]++
+	}
+
+	total := len(img.Pix) / 4
+	if total == 0 {
+		return
+	}
+
+	var lut [256]float64
+	cdf := 0
+	for v := range hist {
+		cdf += hist[v]
+		lut[v] = 255 * math.Pow(float64(cdf)/float64(total), 1/gamma)
+	}
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		y := lum(i)
+		scale := lut[y] / math.Max(float64(y), 1)
+
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(math.Min(float64(img.Pix[i+c])*scale, 255))
+		}
+	}
+}
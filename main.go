@@ -2,38 +2,235 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nats-io/nats"
 	messages "github.com/nicholasjackson/drone-messages"
 )
 
-var processing = false
 var faceProcessor *FaceProcessor
+var frameQueue *FrameQueue
+var chunkAssembler *ChunkAssembler
+var deadLetters *DeadLetterQueue
+var keyring *Keyring
+var scheduler *Scheduler
+var landingConfig LandingConfig
+var landingGuider *LandingGuider
+var colourTracker *ColourTracker
+var gestureDetector *GestureDetector
+var contactEstimator *ContactEstimator
+var lineFollower *LineFollower
 var nc *nats.Conn
 var natsServer = flag.String("nats", "nats://localhost:4222", "connection string for nats server")
+var queueSize = flag.Int("queue", 1, "number of frames which can wait to be processed")
+var droneID = flag.String("drone-id", "drone", "id of the drone whose frames are processed, frames posted for another drone are rejected as the tracking state is not shared between drones")
+var ingestToken = flag.String("ingest-token", "", "bearer token for the HTTP ingest endpoint, the endpoint is disabled when empty")
+var ingestMaxSize = flag.Int64("ingest-max-size", 10<<20, "maximum size in bytes of a frame posted to the HTTP ingest endpoint")
+var chunkTimeout = flag.Duration("chunk-timeout", 2*time.Second, "time to wait for all the chunks of a frame before it is discarded")
+var chunkMaxMemory = flag.Int("chunk-max-memory", 32<<20, "maximum size in bytes of incomplete chunked frames held in memory")
+var deadLetterSubject = flag.String("deadletter-subject", "image.deadletter", "subject to publish frames which fail processing to, disabled when empty")
+var deadLetterDir = flag.String("deadletter-dir", "", "directory to save frames which fail processing to, disabled when empty")
+var hmacKeys = flag.String("hmac-keys", "", "file containing shared HMAC keys, reloaded on SIGHUP")
+var hmacSignKey = flag.String("hmac-sign-key", "", "id of the HMAC key used to sign published results when the key file has no sign line, results are unsigned when empty")
+var hmacMaxAge = flag.Duration("hmac-max-age", 30*time.Second, "largest clock difference allowed between signing and verifying a message, older messages are rejected")
+var verifyFrames = flag.Bool("verify-frames", false, "reject frames which are not signed with a known HMAC key")
+var evaluateDir = flag.String("evaluate", "", "evaluate every verification rule against fixture images in dir/positive and dir/negative then exit")
+var cadenceEnabled = flag.Bool("cadence", false, "adapt the face detection rate to recent detection activity and latency")
+var cadenceMinRate = flag.Float64("cadence-min-rate", 1, "minimum frames per second processed when no face has been seen")
+var cadenceMaxRate = flag.Float64("cadence-max-rate", 30, "maximum frames per second processed while faces are being seen")
+var cadenceIdleAfter = flag.Duration("cadence-idle-after", 5*time.Second, "time without a face before the processing rate starts to decay")
+var targetMode = flag.String("target", "face", "target to detect and publish, face or colour")
+var colourLower = flag.String("colour-lower", "5,150,120", "lower bound h,s,v of the colour target, hue is 0 to 180")
+var colourUpper = flag.String("colour-upper", "25,255,255", "upper bound h,s,v of the colour target, a lower hue above the upper hue wraps around red")
+var colourMinArea = flag.Float64("colour-min-area", 400, "smallest area in pixels of a colour target")
+var colourKernel = flag.Int("colour-kernel", 5, "size in pixels of the kernel used to clean up the colour mask")
+var gestures = flag.Bool("gestures", false, "arm hand gesture flight commands when the service starts, they can be armed at runtime with a signed message and disarmed with any message on "+MessageGestureEnable)
+var gesturePalmCascade = flag.String("palm-cascade", "", "cascade used to find open palms for gesture commands")
+var gestureFistCascade = flag.String("fist-cascade", "", "cascade used to find fists for gesture commands")
+var gestureHold = flag.Duration("gesture-hold", 2*time.Second, "time a gesture must be held before its command is sent")
+var contactAction = flag.String("contact", "off", "time to contact obstacle warning from optical flow, off, warn, hover or backoff")
+var contactRegion = flag.Float64("contact-region", 0.5, "fraction of the frame, centred in the frame, in which the time to contact is measured")
+var contactThreshold = flag.Duration("contact-threshold", 2*time.Second, "time to contact below which a warning is raised")
+var contactSpeed = flag.Int("contact-speed", 30, "speed of the back off command, 1 to 100")
+var contactCooldown = flag.Duration("contact-cooldown", time.Second, "minimum time between obstacle flight commands")
+var lineMode = flag.String("line", "off", "painted line detection on frames from the downward camera published to "+MessageDroneImageDown+", off, detect or follow which also sends yaw and lateral commands")
+var lineVotes = flag.Int("line-votes", 50, "Hough accumulator threshold for a line segment")
+var lineMinLength = flag.Float64("line-min-length", 100, "smallest total length in pixels of the segments making up the line")
+var lineAngleTolerance = flag.Float64("line-angle-tolerance", 5, "angle in degrees within which the drone is aligned with the line")
+var lineOffsetTolerance = flag.Float64("line-offset-tolerance", 0.1, "offset as a fraction of half the frame within which the drone is over the line")
+var lineYawGain = flag.Float64("line-yaw-gain", 100, "yaw speed for a line angle of 90 degrees")
+var lineLateralGain = flag.Float64("line-lateral-gain", 60, "lateral speed for a line offset of half the frame")
+var lineMaxSpeed = flag.Int("line-max-speed", 30, "maximum speed of a line following command, 1 to 100")
+var landingMode = flag.String("landing", "off", "landing pad detection on frames from the downward camera published to "+MessageDroneImageDown+", off, detect or guide which also corrects the position while landing")
+var landingMinRadius = flag.Int("landing-min-radius", 20, "smallest apparent radius of a landing pad in pixels")
+var landingTolerance = flag.Float64("landing-tolerance", 0.1, "offset as a fraction of half the frame within which the landing pad is centred")
+var landingGain = flag.Float64("landing-gain", 60, "correction speed for a landing pad offset of half the frame")
+var landingMaxSpeed = flag.Int("landing-max-speed", 30, "maximum speed of a landing correction, 1 to 100")
+var landingTimeout = flag.Duration("landing-timeout", 15*time.Second, "time corrections are issued for after a land command")
+var publishUnverified = flag.Bool("publish-unverified", false, "publish results when only unverified candidate faces are found")
 
 func main() {
 	flag.Parse()
 
-	var err error
+	config, err := faceProcessorConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *evaluateDir != "" {
+		// fixtures are unrelated images so the temporal filters are disabled
+		config.Confirm.Mode = ConfirmOff
+		config.Static.Mode = StaticOff
+	}
+
+	cadence := CadenceConfig{
+		Enabled:   *cadenceEnabled,
+		MinRate:   *cadenceMinRate,
+		MaxRate:   *cadenceMaxRate,
+		IdleAfter: *cadenceIdleAfter,
+	}
+
+	if err := cadence.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := validateChunkSettings(*chunkTimeout, *chunkMaxMemory); err != nil {
+		log.Fatal(err)
+	}
+
+	landingConfig = LandingConfig{
+		Mode:      LandingMode(*landingMode),
+		MinRadius: *landingMinRadius,
+		Tolerance: *landingTolerance,
+		Gain:      *landingGain,
+		MaxSpeed:  *landingMaxSpeed,
+		Timeout:   *landingTimeout,
+	}
+
+	if err := landingConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	faceProcessor = NewFaceProcessor(config)
+
+	switch TargetMode(*targetMode) {
+	case TargetFace:
+	case TargetColour:
+		colourTracker, err = newColourTracker()
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("Unknown target %s, expected face or colour", *targetMode)
+	}
+
+	if config.ProfileCascade != "" && faceProcessor.profileclassifier == nil {
+		log.Fatalf("Unable to load profile cascade %s", config.ProfileCascade)
+	}
+
+	for _, f := range []string{FeatureNose, FeatureMouth, FeatureSmile} {
+		if config.Verification.Uses(f) && !faceProcessor.HasFeature(f) {
+			log.Fatalf("Verification uses %s but no %s cascade is loaded", f, f)
+		}
+	}
+
+	if *evaluateDir != "" {
+		policies := PolicyCombinations(faceProcessor.AvailableFeatures())
+		if config.Verification.Mode == VerifyWeighted {
+			policies = append(policies, config.Verification)
+		}
+
+		if err := EvaluatePolicies(faceProcessor, *evaluateDir, policies, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if *contactAction != "off" {
+		contactEstimator, err = newContactEstimator()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer contactEstimator.Close()
+	}
+
+	if LineMode(*lineMode) != LineOff {
+		lineFollower, err = newLineFollower()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *gestures || *gesturePalmCascade != "" || *gestureFistCascade != "" {
+		gestureDetector, err = newGestureDetector(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	nc, err = nats.Connect(*natsServer)
 	if err != nil {
 		log.Fatal("Unable to connect to nats")
 	}
 
-	faceProcessor = NewFaceProcessor()
-
-	sub, _ := nc.Subscribe(messages.MessageDroneImage, func(m *nats.Msg) {
-		if !processing {
-			go processMessage(m)
+	if *hmacKeys != "" {
+		keyring, err = NewKeyring(*hmacKeys, *hmacSignKey, *hmacMaxAge)
+		if err != nil {
+			log.Fatal("Unable to load HMAC keys", err)
 		}
-	})
+
+		go reloadKeys()
+	} else if *verifyFrames || *hmacSignKey != "" {
+		log.Fatal("HMAC keys must be specified to sign or verify messages")
+	}
+
+	deadLetters = NewDeadLetterQueue(*deadLetterSubject, *deadLetterDir)
+
+	scheduler = NewScheduler(cadence)
+
+	frameQueue = NewFrameQueue(*queueSize)
+	go frameQueue.Run(processFrame)
+
+	chunkAssembler = NewChunkAssembler(*chunkTimeout, *chunkMaxMemory)
+	go expireChunks()
+
+	sub, _ := nc.Subscribe(messages.MessageDroneImage, handleMessage)
 	defer sub.Unsubscribe()
 
+	formatSub, _ := nc.Subscribe(messages.MessageDroneImage+".*", handleMessage)
+	defer formatSub.Unsubscribe()
+
+	chunkSub, _ := nc.Subscribe(MessageDroneImageChunk, handleChunk)
+	defer chunkSub.Unsubscribe()
+
+	if gestureDetector != nil {
+		gestureSub, _ := nc.Subscribe(MessageGestureEnable, gestureDetector.HandleEnable)
+		defer gestureSub.Unsubscribe()
+	}
+
+	if landingConfig.Mode != LandingOff || lineFollower != nil {
+		downSub, _ := nc.Subscribe(MessageDroneImageDown, handleMessage)
+		defer downSub.Unsubscribe()
+
+		downFormatSub, _ := nc.Subscribe(MessageDroneImageDown+".*", handleMessage)
+		defer downFormatSub.Unsubscribe()
+	}
+
+	if landingConfig.Mode == LandingGuide {
+		landingGuider = NewLandingGuider(landingConfig)
+
+		flightSub, _ := nc.Subscribe(messages.MessageFlight, landingGuider.HandleFlight)
+		defer flightSub.Unsubscribe()
+	}
+
 	startServer()
 
 	handleExit()
@@ -45,29 +242,428 @@ func handleExit() {
 	<-c
 }
 
-func processMessage(m *nats.Msg) {
-	processing = true
-	defer func() { processing = false }()
+// reloadKeys reloads the HMAC keys when the process receives SIGHUP
+func reloadKeys() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		if err := keyring.Reload(); err != nil {
+			log.Println("Unable to reload HMAC keys", err)
+			continue
+		}
+
+		log.Println("Reloaded HMAC keys")
+	}
+}
+
+// verifyMessage returns the payload of a signed message, when verification is
+// disabled the message data is returned unchanged
+func verifyMessage(m *nats.Msg) ([]byte, bool) {
+	if !*verifyFrames {
+		return m.Data, true
+	}
+
+	data, err := keyring.Verify(m.Subject, m.Data)
+	if err != nil {
+		metricFramesRejected.Add(err.Error(), 1)
+		log.Println("Rejected frame on", m.Subject, err)
+		return nil, false
+	}
+
+	return data, true
+}
+
+// verifyCommand returns the payload of a control message, signed messages are
+// verified whenever keys are loaded so that the service can read its own signed
+// commands, unsigned messages are rejected when verification is enabled
+func verifyCommand(m *nats.Msg) ([]byte, bool) {
+	if keyring == nil {
+		return m.Data, true
+	}
+
+	data, err := keyring.Verify(m.Subject, m.Data)
+	if err == errUnsigned && !*verifyFrames {
+		return m.Data, true
+	}
+
+	if err != nil {
+		log.Println("Rejected message on", m.Subject, err)
+		return nil, false
+	}
+
+	return data, true
+}
+
+// verifySigned returns the payload of a message which must be signed, it
+// returns errUnsigned when the message is not signed or no keys are loaded
+func verifySigned(m *nats.Msg) ([]byte, error) {
+	if keyring == nil {
+		return nil, errUnsigned
+	}
+
+	return keyring.Verify(m.Subject, m.Data)
+}
+
+// publish sends a message signing it when a signing key is configured
+func publish(subject string, data []byte) {
+	if keyring != nil && keyring.CanSign() {
+		data = keyring.Sign(subject, data)
+	}
+
+	if err := nc.Publish(subject, data); err != nil {
+		log.Println("Unable to publish message", subject, err)
+	}
+}
+
+// recoverDecode sends a payload whose decoding panicked to the dead letter
+// queue, a panic in a NATS handler would otherwise stop the service
+func recoverDecode(source string, payload []byte) {
+	if r := recover(); r != nil {
+		deadLetters.Send(FailureDecode, fmt.Errorf("panic: %v", r), &frame{Source: source, Data: payload})
+	}
+}
+
+func handleMessage(m *nats.Msg) {
+	defer recoverDecode("nats", m.Data)
+
+	down := strings.HasPrefix(m.Subject, MessageDroneImageDown)
+
+	payload, ok := verifyMessage(m)
+	if !ok {
+		return
+	}
+
+	format, err := payloadFormatFromSubject(m.Subject)
+	if err != nil {
+		deadLetters.Send(FailureDecode, err, &frame{Source: "nats", Data: payload})
+		return
+	}
+
+	data, err := decodePayload(format, payload)
+	if err != nil {
+		deadLetters.Send(FailureDecode, err, &frame{Source: "nats", Data: payload})
+		return
+	}
+
+	enqueueImage("nats", data, down)
+}
+
+func handleChunk(m *nats.Msg) {
+	defer recoverDecode("nats-chunked", m.Data)
+
+	payload, ok := verifyMessage(m)
+	if !ok {
+		return
+	}
+
+	fc := FrameChunk{}
+	if err := fc.DecodeMessage(payload); err != nil {
+		deadLetters.Send(FailureDecode, err, &frame{Source: "nats-chunked", Data: payload})
+		return
+	}
+
+	data, err := chunkAssembler.Add(&fc)
+	if err != nil {
+		log.Println("Discarding chunked frame", fc.FrameID, err)
+		return
+	}
+
+	if data == nil {
+		return
+	}
+
+	image, err := decodeImageData(data)
+	if err != nil {
+		deadLetters.Send(FailureDecode, err, &frame{Source: "nats-chunked", Data: data})
+		return
+	}
+
+	enqueueImage("nats-chunked", image, false)
+}
+
+// expireChunks periodically discards chunked frames which will never complete
+func expireChunks() {
+	for range time.Tick(*chunkTimeout) {
+		chunkAssembler.Expire()
+	}
+}
+
+func enqueueImage(source string, data []byte, down bool) {
+	metricFramesReceived.Add(1)
+
+	// frames are dropped when the queue is full
+	err := frameQueue.Enqueue(&frame{DroneID: *droneID, Source: source, Data: data, Down: down, Received: time.Now()})
+	if err == errQueueFull {
+		metricFramesDropped.Add(1)
+	}
+}
+
+func processFrame(f *frame) {
+	// a panic in the detector must not stop the processing of later frames
+	defer func() {
+		if r := recover(); r != nil {
+			deadLetters.Send(FailureDetector, fmt.Errorf("panic: %v", r), f)
+		}
+	}()
+
+	if f.Down {
+		processDownward(f)
+		return
+	}
 
 	filename := "./latest.jpg"
-	di := messages.DroneImage{}
-	di.DecodeMessage(m.Data)
-	di.SaveDataToFile(filename)
-
-	faces, bounds := faceProcessor.DetectFaces(filename)
-	if len(faces) > 0 {
-		fdm := messages.FaceDetected{
-			Faces:  faces,
-			Bounds: bounds,
+	if err := saveFrame(filename, f.Data); err != nil {
+		deadLetters.Send(FailureStorage, err, f)
+		return
+	}
+
+	// the obstacle module runs on every frame, only face detection follows
+	// the cadence
+	if contactEstimator != nil {
+		processContact(filename, f.Received)
+	}
+
+	if !scheduler.Allow(f.Received) {
+		return
+	}
+
+	start := time.Now()
+
+	var d *Detection
+	var err error
+	if colourTracker != nil {
+		d, err = colourTracker.Detect(filename)
+	} else {
+		d, err = faceProcessor.DetectFaces(filename)
+	}
+
+	if err != nil {
+		deadLetters.Send(failureKind(err), err, f)
+		return
+	}
+
+	if config := faceProcessor.config.Quality; config.ExposureHints && d.Quality != nil {
+		if hint := d.Quality.exposureHint(config); hint != nil {
+			publish(MessageExposureHint, hint.EncodeMessage())
 		}
+	}
+
+	if gestureDetector != nil && colourTracker == nil {
+		f, err := gestureDetector.Detect(filename, d.Faces)
+		if err != nil {
+			log.Println("Unable to detect gestures", err)
+		} else if f != nil {
+			log.Println("Gesture command", f.Command)
+			publishFlight(*f)
+		}
+	}
+
+	fr := NewFaceResult(d)
+	fr.DroneID = f.DroneID
+	scheduler.Record(time.Now(), time.Since(start), len(fr.Faces) > 0)
+
+	if len(fr.Faces) > 0 || (*publishUnverified && len(fr.Details) > 0) {
+		publish(messages.MessageFaceDetection, fr.EncodeMessage())
+	}
+}
+
+// newColourTracker creates the colour target tracker from the flags
+func newColourTracker() (*ColourTracker, error) {
+	lower, err := ParseHSV(*colourLower)
+	if err != nil {
+		return nil, err
+	}
+
+	upper, err := ParseHSV(*colourUpper)
+	if err != nil {
+		return nil, err
+	}
+
+	config := ColourConfig{
+		Lower:   lower,
+		Upper:   upper,
+		MinArea: *colourMinArea,
+		Kernel:  *colourKernel,
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewColourTracker(config), nil
+}
+
+// newGestureDetector creates the gesture detector from the flags, gestures
+// are only accepted from confirmed faces so confirmation must be enabled
+func newGestureDetector(config FaceProcessorConfig) (*GestureDetector, error) {
+	if config.Confirm.Mode == ConfirmOff {
+		return nil, fmt.Errorf("gestures require face confirmation, set -confirm to mark or filter")
+	}
 
-		nc.Publish(messages.MessageFaceDetection, fdm.EncodeMessage())
+	gc := GestureConfig{
+		Enabled:     *gestures,
+		PalmCascade: *gesturePalmCascade,
+		FistCascade: *gestureFistCascade,
+		Hold:        *gestureHold,
 	}
+
+	if err := gc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewGestureDetector(gc)
+}
+
+// newContactEstimator creates the time to contact estimator from the flags
+func newContactEstimator() (*ContactEstimator, error) {
+	cc := ContactConfig{
+		Action:    ContactAction(*contactAction),
+		Region:    *contactRegion,
+		Threshold: *contactThreshold,
+		Speed:     *contactSpeed,
+		Cooldown:  *contactCooldown,
+	}
+
+	if err := cc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewContactEstimator(cc), nil
+}
+
+// processContact publishes the time to contact and stops or backs off the
+// drone when contact is imminent
+func processContact(filename string, received time.Time) {
+	tc, err := contactEstimator.Estimate(filename, received)
+	if err != nil {
+		log.Println("Unable to estimate time to contact", err)
+		return
+	}
+
+	if tc == nil {
+		return
+	}
+
+	publish(MessageTimeToContact, tc.EncodeMessage())
+
+	if f := contactEstimator.Command(tc); f != nil {
+		log.Println("Obstacle ahead, time to contact", tc.Seconds, f.Command)
+		publishFlight(*f)
+	}
+}
+
+// newLineFollower creates the line follower from the flags
+func newLineFollower() (*LineFollower, error) {
+	lc := LineConfig{
+		Mode:            LineMode(*lineMode),
+		Votes:           *lineVotes,
+		MinLength:       *lineMinLength,
+		AngleTolerance:  *lineAngleTolerance,
+		OffsetTolerance: *lineOffsetTolerance,
+		YawGain:         *lineYawGain,
+		LateralGain:     *lineLateralGain,
+		MaxSpeed:        *lineMaxSpeed,
+	}
+
+	if err := lc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewLineFollower(lc), nil
+}
+
+// processLine publishes the position of the line and, when following, the
+// commands which keep the drone over it
+func processLine(filename string) {
+	lr, err := lineFollower.Detect(filename)
+	if err != nil {
+		log.Println("Unable to detect line", err)
+		return
+	}
+
+	if lr.Found {
+		publish(MessageLine, lr.EncodeMessage())
+	}
+
+	for _, f := range lineFollower.Command(lr) {
+		publishFlight(f)
+	}
+}
+
+// processDownward runs the landing pad and line detectors on a frame from the
+// downward camera
+func processDownward(f *frame) {
+	filename := "./down.jpg"
+	if err := saveFrame(filename, f.Data); err != nil {
+		deadLetters.Send(FailureStorage, err, f)
+		return
+	}
+
+	if landingConfig.Mode != LandingOff {
+		processLandingPad(filename)
+	}
+
+	if lineFollower != nil {
+		processLine(filename)
+	}
+}
+
+// processLandingPad publishes the position of the landing pad and, when
+// guiding, the corrections which centre the drone over it
+func processLandingPad(filename string) {
+	pad, err := DetectLandingPad(filename, landingConfig.MinRadius)
+	if err != nil {
+		log.Println("Unable to detect landing pad", err)
+		return
+	}
+
+	if pad.Found {
+		publish(MessageLandingPad, pad.EncodeMessage())
+	}
+
+	if landingGuider != nil {
+		for _, f := range landingGuider.Correct(pad) {
+			publishFlight(f)
+		}
+	}
+}
+
+// saveFrame writes the frame data to filename so that it can be read by the
+// face processor and served to the browser
+func saveFrame(filename string, data []byte) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
 }
 
 func startServer() {
-	fs := http.FileServer(http.Dir("./"))
-	http.Handle("/", fs)
+	// only the page and the frames it shows are served as the working
+	// directory may hold keys or dead letters
+	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+			http.NotFound(rw, r)
+			return
+		}
+
+		http.ServeFile(rw, r, "./index.html")
+	})
+
+	for _, name := range []string{"latest.jpg", "detect.jpg"} {
+		file := "./" + name
+		http.HandleFunc("/"+name, func(rw http.ResponseWriter, r *http.Request) {
+			http.ServeFile(rw, r, file)
+		})
+	}
+
+	if *ingestToken != "" {
+		http.Handle("/ingest/", NewIngestHandler(*ingestToken, *ingestMaxSize, *droneID, frameQueue))
+	}
 
 	log.Println("Listening...")
 	http.ListenAndServe(":4000", nil)
@@ -0,0 +1,50 @@
+package main
+
+import "expvar"
+
+// metrics are published in JSON format by the http server at /debug/vars
+var (
+	metricFramesReceived = expvar.NewInt("frames_received")
+	metricFramesDropped  = expvar.NewInt("frames_dropped")
+	metricFailures       = expvar.NewMap("frame_failures")
+	metricFramesRejected = expvar.NewMap("frames_rejected")
+
+	metricChunksReceived        = expvar.NewInt("chunks_received")
+	metricChunkedFramesComplete = expvar.NewInt("chunked_frames_complete")
+	metricChunkedFramesDiscard  = expvar.NewMap("chunked_frames_discarded")
+
+	metricROIHits      = expvar.NewInt("roi_fast_path_hits")
+	metricROIMisses    = expvar.NewInt("roi_fast_path_misses")
+	metricROIFullScans = expvar.NewInt("roi_full_scans")
+
+	metricSkinRejected = expvar.NewInt("skin_rejected_faces")
+	metricSkinRegions  = expvar.NewInt("skin_regions_searched")
+
+	metricStaticFaces = expvar.NewInt("static_faces")
+
+	metricSharpness  = expvar.NewFloat("frame_sharpness")
+	metricBrightness = expvar.NewFloat("frame_brightness")
+	metricContrast   = expvar.NewFloat("frame_contrast")
+	metricLowQuality = expvar.NewMap("frames_low_quality")
+
+	metricLowLightFrames = expvar.NewInt("low_light_frames")
+
+	metricFacesConfirmed = expvar.NewInt("faces_confirmed")
+	metricFacesLost      = expvar.NewInt("faces_lost")
+
+	metricProcessingRate = expvar.NewFloat("processing_rate")
+	metricFramesSkipped  = expvar.NewInt("frames_skipped_cadence")
+
+	metricQualityLevel = expvar.NewInt("quality_level")
+
+	metricLandingPads = expvar.NewInt("landing_pads_found")
+
+	metricColourTargets = expvar.NewInt("colour_targets_found")
+
+	metricGestures = expvar.NewMap("gesture_commands")
+
+	metricExpansion       = expvar.NewFloat("contact_expansion")
+	metricContactCommands = expvar.NewInt("contact_commands")
+
+	metricLinesFound = expvar.NewInt("lines_found")
+)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// flowScale is the scale frames are reduced to before calculating optical
+// flow, dense flow at full resolution is too slow to run every frame
+const flowScale = 0.5
+
+// opticalFlow calculates dense optical flow between consecutive frames
+type opticalFlow struct {
+	previous gocv.Mat
+	hasPrev  bool
+}
+
+// motionField is the dense optical flow for a frame, coordinates passed to
+// its methods are in frame coordinates
+type motionField struct {
+	flow gocv.Mat
+}
+
+// next calculates the flow between the previous frame and img, ok is false
+// when there is no previous frame of the same size
+func (of *opticalFlow) next(img gocv.Mat) (mf motionField, ok bool) {
+	gray := gocv.NewMat()
+	gocv.CvtColor(img, gray, gocv.ColorBGRToGray)
+	gocv.Resize(gray, gray, image.Point{}, flowScale, flowScale, gocv.InterpolationArea)
+
+	defer func() {
+		if of.hasPrev {
+			of.previous.Close()
+		}
+
+		of.previous, of.hasPrev = gray, true
+	}()
+
+	if !of.hasPrev || of.previous.Rows() != gray.Rows() || of.previous.Cols() != gray.Cols() {
+		return motionField{}, false
+	}
+
+	flow := gocv.NewMat()
+	gocv.CalcOpticalFlowFarneback(of.previous, gray, flow, 0.5, 3, 15, 3, 5, 1.2, 0)
+
+	return motionField{flow: flow}, true
+}
+
+// Close releases the previous frame
+func (of *opticalFlow) Close() {
+	if of.hasPrev {
+		of.previous.Close()
+		of.hasPrev = false
+	}
+}
+
+// Close releases the flow
+func (mf motionField) Close() {
+	mf.flow.Close()
+}
+
+// global returns the mean motion of the whole frame in frame pixels
+func (mf motionField) global() (dx, dy float64) {
+	m := mf.flow.Mean()
+	return m.Val1 / flowScale, m.Val2 / flowScale
+}
+
+// region returns the mean motion within r in frame pixels
+func (mf motionField) region(r image.Rectangle) (dx, dy float64) {
+	scaled := image.Rect(
+		int(float64(r.Min.X)*flowScale), int(float64(r.Min.Y)*flowScale),
+		int(float64(r.Max.X)*flowScale), int(float64(r.Max.Y)*flowScale),
+	).Intersect(image.Rect(0, 0, mf.flow.Cols(), mf.flow.Rows()))
+
+	if scaled.Empty() {
+		return 0, 0
+	}
+
+	region := mf.flow.Region(scaled)
+	defer region.Close()
+
+	m := region.Mean()
+	return m.Val1 / flowScale, m.Val2 / flowScale
+}
+
+// relative returns the magnitude of the motion within r relative to the
+// motion of the whole frame
+func (mf motionField) relative(r image.Rectangle) float64 {
+	gx, gy := mf.global()
+	rx, ry := mf.region(r)
+
+	return math.Hypot(rx-gx, ry-gy)
+}
+
+// divergence returns the expansion of the motion within r per frame, the
+// difference between the flow of opposite halves of r divided by the distance
+// between their centres, a surface approaching the camera has a positive
+// divergence of twice its relative rate of approach
+func (mf motionField) divergence(r image.Rectangle) float64 {
+	if r.Dx() < 2 || r.Dy() < 2 {
+		return 0
+	}
+
+	mid := center(r)
+	left := image.Rect(r.Min.X, r.Min.Y, mid.X, r.Max.Y)
+	right := image.Rect(mid.X, r.Min.Y, r.Max.X, r.Max.Y)
+	top := image.Rect(r.Min.X, r.Min.Y, r.Max.X, mid.Y)
+	bottom := image.Rect(r.Min.X, mid.Y, r.Max.X, r.Max.Y)
+
+	lx, _ := mf.region(left)
+	rx, _ := mf.region(right)
+	_, ty := mf.region(top)
+	_, by := mf.region(bottom)
+
+	return (rx-lx)/float64(r.Dx()/2) + (by-ty)/float64(r.Dy()/2)
+}
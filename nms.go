@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// MergeMode defines how overlapping detections of the same face are combined
+type MergeMode string
+
+const (
+	// MergeNone publishes every detection
+	MergeNone MergeMode = "none"
+	// MergeNMS keeps the highest scoring detection from each overlapping group,
+	// when scores are equal the largest detection is kept
+	MergeNMS MergeMode = "nms"
+	// MergeWeighted replaces each overlapping group with the score weighted
+	// average of its rectangles
+	MergeWeighted MergeMode = "weighted"
+)
+
+// ParseMergeMode returns the MergeMode for the given name
+func ParseMergeMode(name string) (MergeMode, error) {
+	switch m := MergeMode(name); m {
+	case MergeNone, MergeNMS, MergeWeighted:
+		return m, nil
+	}
+
+	return "", fmt.Errorf("unknown merge mode %s, expected none, nms or weighted", name)
+}
+
+// IoU returns the intersection over union of two rectangles
+func IoU(a, b image.Rectangle) float64 {
+	in := a.Intersect(b)
+	if in.Empty() {
+		return 0
+	}
+
+	ia := area(in)
+	return ia / (area(a) + area(b) - ia)
+}
+
+func area(r image.Rectangle) float64 {
+	return float64(r.Dx() * r.Dy())
+}
+
+// MergeRectangles groups rectangles which overlap by at least threshold IoU
+// and returns one rectangle for each group along with the indexes of the
+// rectangles in the group. Scores rank the rectangles, when nil all rectangles
+// are ranked equally.
+func MergeRectangles(rects []image.Rectangle, scores []float64, mode MergeMode, threshold float64) ([]image.Rectangle, [][]int) {
+	if scores == nil {
+		scores = make([]float64, len(rects))
+		for i := range scores {
+			scores[i] = 1
+		}
+	}
+
+	if mode == MergeNone {
+		groups := make([][]int, len(rects))
+		for i := range rects {
+			groups[i] = []int{i}
+		}
+
+		return rects, groups
+	}
+
+	// rank by score then by size so the strongest rectangle leads each group
+	order := make([]int, len(rects))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+
+		return area(rects[a]) > area(rects[b])
+	})
+
+	used := make([]bool, len(rects))
+	merged := make([]image.Rectangle, 0)
+	groups := make([][]int, 0)
+
+	for _, i := range order {
+		if used[i] {
+			continue
+		}
+
+		group := []int{i}
+		used[i] = true
+
+		for _, j := range order {
+			if !used[j] && IoU(rects[i], rects[j]) >= threshold {
+				group = append(group, j)
+				used[j] = true
+			}
+		}
+
+		if mode == MergeWeighted {
+			merged = append(merged, weightedRectangle(rects, scores, group))
+		} else {
+			merged = append(merged, rects[i])
+		}
+
+		groups = append(groups, group)
+	}
+
+	return merged, groups
+}
+
+func weightedRectangle(rects []image.Rectangle, scores []float64, group []int) image.Rectangle {
+	var x0, y0, x1, y1, total float64
+	for _, i := range group {
+		w := scores[i]
+		x0 += float64(rects[i].Min.X) * w
+		y0 += float64(rects[i].Min.Y) * w
+		x1 += float64(rects[i].Max.X) * w
+		y1 += float64(rects[i].Max.Y) * w
+		total += w
+	}
+
+	if total == 0 {
+		return rects[group[0]]
+	}
+
+	return image.Rect(
+		int(x0/total+0.5), int(y0/total+0.5),
+		int(x1/total+0.5), int(y1/total+0.5),
+	)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"image"
 	"image/color"
 	"log"
+	"time"
 
 	"gocv.io/x/gocv"
 )
@@ -23,15 +25,125 @@ func (s BySize) Less(i, j int) bool {
 
 var blue = color.RGBA{0, 0, 255, 0}
 
+var errEmptyImage = errors.New("unable to read image")
+
+// minNeighbours is the number of raw cascade detections needed to accept a
+// face and neighbourThreshold the overlap at which they are grouped
+const (
+	minNeighbours      = 3
+	neighbourThreshold = 0.5
+)
+
+// FaceProcessorConfig defines the settings for a FaceProcessor
+type FaceProcessorConfig struct {
+	// MergeMode and MergeThreshold control how overlapping detections of the
+	// same face are combined
+	MergeMode      MergeMode
+	MergeThreshold float64
+
+	// Verification decides which candidate faces are verified
+	Verification VerificationPolicy
+
+	// optional cascades which provide extra evidence for verification, a
+	// cascade is not used when its path is empty
+	NoseCascade  string
+	MouthCascade string
+	SmileCascade string
+
+	// RotationAngles are the angles in degrees the frame is rotated by to find
+	// tilted faces, rotation is disabled when empty
+	RotationAngles []float64
+
+	// ProfileCascade is the path to a profile face cascade, when set faces
+	// turned to the side are also detected
+	ProfileCascade string
+
+	// ROI enables searching around previous detections before scanning the
+	// whole frame
+	ROI ROIConfig
+
+	// Tiles enables searching high resolution frames in overlapping tiles
+	Tiles TileConfig
+
+	// Skin filters candidate faces by their skin colour
+	Skin SkinConfig
+
+	// Static marks or drops faces which never move relative to the scene
+	Static StaticConfig
+
+	// Quality measures the sharpness and exposure of each frame and can skip
+	// frames which are too poor to run detection on
+	Quality QualityConfig
+
+	// LowLight enhances dark frames and inverts thermal frames
+	LowLight LowLightConfig
+
+	// Confirm requires faces to be seen across several frames before they
+	// are confirmed
+	Confirm ConfirmConfig
+
+	// Budget degrades the detection quality when frames take too long
+	Budget BudgetConfig
+}
+
+// Detection is the result of processing a single frame
+type Detection struct {
+	Faces  []Face
+	Bounds image.Rectangle
+	// Quality is nil when quality assessment is disabled
+	Quality *FrameQuality
+	// LowLight is true when the low light profile was applied to the frame
+	LowLight bool
+	// QualityLevel is the active quality level, 0 is full quality and higher
+	// levels are used when detection exceeds the latency budget
+	QualityLevel int
+}
+
+// searchParams are the cascade settings used when searching for faces
+type searchParams struct {
+	scale   float64
+	minSize image.Point
+	maxSize image.Point
+	// resize reduces the resolution of the image before it is searched
+	resize float64
+	// skipVerify accepts every candidate face without searching for features
+	skipVerify bool
+}
+
+// fullSearch is used to search the whole frame
+var fullSearch = searchParams{
+	scale:   1.03,
+	minSize: image.Point{X: 10, Y: 10},
+	maxSize: image.Point{X: 200, Y: 200},
+	resize:  1,
+}
+
 // FaceProcessor detects the position of a face from an input image
 type FaceProcessor struct {
+	config          FaceProcessorConfig
 	faceclassifier  *gocv.CascadeClassifier
 	eyeclassifier   *gocv.CascadeClassifier
 	glassclassifier *gocv.CascadeClassifier
+	noseclassifier  *gocv.CascadeClassifier
+	mouthclassifier *gocv.CascadeClassifier
+	smileclassifier *gocv.CascadeClassifier
+
+	profileclassifier *gocv.CascadeClassifier
+
+	// faces found in the previous frame, used to measure persistence
+	previous []Face
+	roi      *roiTracker
+	static   *staticSuppressor
+	confirm  *confirmer
+	budget   *budgetController
+	search   searchParams
+
+	// face processors used to search tiles in parallel
+	tileWorkers []*FaceProcessor
 }
 
 // NewFaceProcessor creates a new face processor loading any dependent settings
-func NewFaceProcessor() *FaceProcessor {
+func NewFaceProcessor(config FaceProcessorConfig) *FaceProcessor {
 	// load classifier to recognize faces
 	classifier1 := gocv.NewCascadeClassifier()
 	classifier1.Load("./data/haarcascade_frontalface_default.xml")
@@ -42,56 +154,427 @@ func NewFaceProcessor() *FaceProcessor {
 	classifier3 := gocv.NewCascadeClassifier()
 	classifier3.Load("./data/haarcascade_eye_tree_eyeglasses.xml")
 
-	return &FaceProcessor{
+	fp := &FaceProcessor{
+		config:          config,
 		faceclassifier:  &classifier1,
 		eyeclassifier:   &classifier2,
 		glassclassifier: &classifier3,
+		noseclassifier:  loadOptionalClassifier(config.NoseCascade),
+		mouthclassifier: loadOptionalClassifier(config.MouthCascade),
+		smileclassifier: loadOptionalClassifier(config.SmileCascade),
+
+		profileclassifier: loadOptionalClassifier(config.ProfileCascade),
+
+		roi:     &roiTracker{config: config.ROI},
+		static:  &staticSuppressor{config: config.Static},
+		confirm: &confirmer{config: config.Confirm},
+		budget:  &budgetController{config: config.Budget},
+		search:  fullSearch,
+	}
+
+	if config.Tiles.Enabled {
+		fp.tileWorkers = newTileWorkers(config)
+	}
+
+	return fp
+}
+
+// AvailableFeatures returns the features which the face processor can detect
+func (fp *FaceProcessor) AvailableFeatures() []string {
+	features := []string{FeatureEyes, FeatureGlasses}
+
+	if fp.noseclassifier != nil {
+		features = append(features, FeatureNose)
+	}
+
+	if fp.mouthclassifier != nil {
+		features = append(features, FeatureMouth)
+	}
+
+	if fp.smileclassifier != nil {
+		features = append(features, FeatureSmile)
+	}
+
+	return features
+}
+
+// HasFeature returns true when the face processor can detect the feature
+func (fp *FaceProcessor) HasFeature(feature string) bool {
+	for _, f := range fp.AvailableFeatures() {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadOptionalClassifier loads the cascade at path, nil is returned when the
+// path is empty or the cascade can not be loaded
+func loadOptionalClassifier(path string) *gocv.CascadeClassifier {
+	if path == "" {
+		return nil
+	}
+
+	classifier := gocv.NewCascadeClassifier()
+	if !classifier.Load(path) {
+		log.Println("Unable to load cascade", path)
+		classifier.Close()
+		return nil
 	}
+
+	return &classifier
+}
+
+// detectFeature finds a facial feature within the face region, nothing is
+// returned when the classifier has not been loaded
+func detectFeature(classifier *gocv.CascadeClassifier, faceImage gocv.Mat, offset image.Point) []image.Rectangle {
+	if classifier == nil {
+		return nil
+	}
+
+	features := classifier.DetectMultiScaleWithParams(
+		faceImage, 1.03, 3, 0, image.Point{X: 0, Y: 0}, image.Point{X: 100, Y: 100},
+	)
+
+	return offsetRectangles(features, offset)
 }
 
-// DetectFaces detects faces in the image and returns an array of rectangle
-func (fp *FaceProcessor) DetectFaces(file string) (faces []image.Rectangle, bounds image.Rectangle) {
+// DetectFaces detects faces in the image and returns each candidate face with
+// its confidence, faces which pass verification are marked as Verified
+func (fp *FaceProcessor) DetectFaces(file string) (*Detection, error) {
+	// only frames which are searched are measured, frames skipped by the
+	// quality gate would pull the rolling latency down
+	start := time.Now()
+	searched := false
+	defer func() {
+		if searched {
+			fp.budget.record(time.Since(start))
+		}
+	}()
+
 	img := gocv.IMRead(file, gocv.IMReadColor)
 	defer img.Close()
 
-	bds := image.Rectangle{Min: image.Point{}, Max: image.Point{X: 800, Y: 600}}
+	if img.Empty() {
+		return nil, errEmptyImage
+	}
+
+	d := &Detection{Bounds: image.Rect(0, 0, img.Cols(), img.Rows()), QualityLevel: fp.budget.level}
+	fp.search = fp.budget.params()
+
+	enhanced, lowLight, err := fp.config.LowLight.preprocess(img)
+	if err != nil {
+		return nil, err
+	}
+
+	if lowLight {
+		img.Close()
+		img = enhanced
+		d.LowLight = true
+	}
+
+	// quality is assessed on the frame which is searched so that dark frames
+	// which have been enhanced are not skipped
+	if fp.config.Quality.Action != QualityOff {
+		d.Quality = fp.config.Quality.assessQuality(img)
+		recordQuality(d.Quality)
+
+		if !d.Quality.Passed && fp.config.Quality.Action == QualitySkip {
+			return d, nil
+		}
+	}
+
+	searched = true
 
 	//	gocv.CvtColor(img, img, gocv.ColorRGBToGray)
 	//	gocv.Resize(img, img, image.Point{}, 0.6, 0.6, gocv.InterpolationArea)
 
-	// detect faces
-	tmpfaces := fp.faceclassifier.DetectMultiScaleWithParams(
-		img, 1.03, 3, 0, image.Point{X: 10, Y: 10}, image.Point{X: 200, Y: 200},
+	frame := image.Rect(0, 0, img.Cols(), img.Rows())
+
+	fcs, fast := fp.detectROI(img, fp.roi.windows(frame))
+	if !fast {
+		fcs, err = fp.detectFullFrame(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fp.config.Skin.Mode == SkinReject {
+		fcs = fp.config.Skin.rejectNonSkin(img, fcs)
+	}
+
+	if fp.config.Static.Mode != StaticOff {
+		fcs = fp.static.apply(img, fcs)
+	}
+
+	if fp.config.Confirm.Mode != ConfirmOff {
+		fcs = fp.confirm.apply(fcs)
+	}
+
+	fp.roi.update(fcs, !fast)
+
+	for i := range fcs {
+		face := &fcs[i]
+		face.Evidence.Persistence = persistence(face.Rect, fp.previous)
+		face.Confidence = scoreFace(face)
+
+		if face.Verified {
+			log.Println("found verified face")
+
+			// draw a rectangle around each face on the original image
+			drawFace(img, face)
+			gocv.IMWrite("./detect.jpg", img)
+		}
+	}
+
+	fp.previous = fcs
+	d.Faces = fcs
+
+	return d, nil
+}
+
+// detectFullFrame searches the whole frame for faces
+func (fp *FaceProcessor) detectFullFrame(img gocv.Mat) ([]Face, error) {
+	metricROIFullScans.Add(1)
+
+	var fcs []Face
+	if fp.config.Skin.Mode == SkinRegions {
+		fcs = fp.detectSkinRegions(img)
+	} else if fp.tileWorkers != nil {
+		fcs = fp.detectTiled(img)
+	} else {
+		fcs = fp.detect(fp.faceclassifier, img, OrientationFrontal, fp.search)
+	}
+
+	if len(fp.config.RotationAngles) > 0 || fp.profileclassifier != nil {
+		// the gocv bindings can not rotate or flip a Mat so transformed copies
+		// are created from a Go image of the preprocessed frame
+		src, err := matImage(img)
+		if err != nil {
+			return nil, err
+		}
+
+		rotated, err := fp.detectRotated(src)
+		if err != nil {
+			return nil, err
+		}
+
+		profiles, err := fp.detectProfiles(img, src)
+		if err != nil {
+			return nil, err
+		}
+
+		fcs = append(fcs, rotated...)
+		fcs = mergeFaces(append(fcs, profiles...), fp.config.MergeThreshold)
+	}
+
+	return fcs, nil
+}
+
+// detect finds and verifies the candidate faces in img using the given face
+// classifier
+func (fp *FaceProcessor) detect(classifier *gocv.CascadeClassifier, img gocv.Mat, orientation Orientation, params searchParams) []Face {
+	if params.resize > 0 && params.resize < 1 {
+		return fp.detectResized(classifier, img, orientation, params)
+	}
+
+	// detect faces, the raw detections are grouped here rather than by the
+	// cascade so that the size of each group is known
+	raw := classifier.DetectMultiScaleWithParams(
+		img, params.scale, 0, 0, params.minSize, params.maxSize,
 	)
+	candidates, counts := groupDetections(raw)
+
+	// the groups often overlap for one face
+	tmpfaces, groups := MergeRectangles(candidates, nil, fp.config.MergeMode, fp.config.MergeThreshold)
+
+	fcs := make([]Face, 0)
+
+	for i, f := range tmpfaces {
+		neighbours := 0
+		for _, j := range groups[i] {
+			neighbours += counts[j]
+		}
+
+		// verification is skipped when the latency budget is exceeded, the
+		// candidate is accepted but is not verified
+		if params.skipVerify {
+			fcs = append(fcs, Face{
+				Rect:                f,
+				Orientation:         orientation,
+				VerificationSkipped: true,
+				Evidence:            FaceEvidence{Neighbours: neighbours},
+			})
+
+			continue
+		}
 
-	fcs := make([]image.Rectangle, 0)
+		// detect eyes
+		faceImage := img.Region(f)
 
-	if len(tmpfaces) > 0 {
-		// draw a rectangle around each face on the original image
-		for _, f := range tmpfaces {
-			// detect eyes
-			faceImage := img.Region(f)
+		face := Face{
+			Rect:        f,
+			Orientation: orientation,
+			Evidence: FaceEvidence{
+				Eyes:       detectFeature(fp.eyeclassifier, faceImage, f.Min),
+				Glasses:    detectFeature(fp.glassclassifier, faceImage, f.Min),
+				Nose:       detectFeature(fp.noseclassifier, faceImage, f.Min),
+				Mouth:      detectFeature(fp.mouthclassifier, faceImage, f.Min),
+				Smile:      detectFeature(fp.smileclassifier, faceImage, f.Min),
+				Neighbours: neighbours,
+			},
+		}
+		face.EyeCentres = eyeCentres(face.Evidence.Eyes)
+		face.Landmarks = findEyeLandmarks(f, face.Evidence.Eyes)
+		if face.Landmarks == nil {
+			face.Landmarks = findEyeLandmarks(f, face.Evidence.Glasses)
+		}
 
-			eyes := fp.eyeclassifier.DetectMultiScaleWithParams(
-				faceImage, 1.03, 3, 0, image.Point{X: 0, Y: 0}, image.Point{X: 100, Y: 100},
-			)
+		face.Confidence = scoreFace(&face)
+		face.Verified = fp.config.Verification.Verify(featureCounts(face.Evidence))
 
-			glasses := fp.glassclassifier.DetectMultiScaleWithParams(
-				faceImage, 1.03, 3, 0, image.Point{X: 0, Y: 0}, image.Point{X: 100, Y: 100},
-			)
+		fcs = append(fcs, face)
+	}
 
-			if len(eyes) > 0 || len(glasses) > 0 {
-				log.Println("found with eyes")
+	return fcs
+}
 
-				fcs = append(fcs, f)
+// groupDetections groups the raw cascade detections of the same face and
+// replaces each group with its average rectangle, groups with fewer than
+// minNeighbours detections are dropped as the cascade would. The size of each
+// group is returned with the rectangles
+func groupDetections(raw []image.Rectangle) ([]image.Rectangle, []int) {
+	merged, groups := MergeRectangles(raw, nil, MergeWeighted, neighbourThreshold)
 
-				gocv.Rectangle(img, f, blue, 1)
-				gocv.IMWrite("./detect.jpg", img)
-			}
+	rects := make([]image.Rectangle, 0, len(merged))
+	counts := make([]int, 0, len(merged))
+	for i, g := range groups {
+		if len(g) >= minNeighbours {
+			rects = append(rects, merged[i])
+			counts = append(counts, len(g))
 		}
+	}
+
+	return rects, counts
+}
+
+// detectResized searches a reduced resolution copy of img and maps the faces
+// back to the original resolution
+func (fp *FaceProcessor) detectResized(classifier *gocv.CascadeClassifier, img gocv.Mat, orientation Orientation, params searchParams) []Face {
+	small := gocv.NewMat()
+	defer small.Close()
+
+	gocv.Resize(img, small, image.Point{}, params.resize, params.resize, gocv.InterpolationArea)
+
+	s := scaling(params.resize)
+	params.minSize = scalePoint(params.minSize, params.resize)
+	params.maxSize = scalePoint(params.maxSize, params.resize)
+	params.resize = 1
+
+	fcs := fp.detect(classifier, small, orientation, params)
+	for i := range fcs {
+		fcs[i] = mapFace(s, fcs[i])
+	}
+
+	return fcs
+}
+
+// detectRotated runs detection on copies of the frame rotated by each of the
+// configured angles and maps the faces back to the original frame
+func (fp *FaceProcessor) detectRotated(src image.Image) ([]Face, error) {
+	fcs := make([]Face, 0)
+	for _, a := range fp.config.RotationAngles {
+		r := newRotation(src.Bounds().Size(), a)
+
+		img, err := toMat(r.rotateImage(src))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fp.detect(fp.faceclassifier, img, OrientationFrontal, fp.search) {
+			fcs = append(fcs, r.faceToFrame(f))
+		}
+
+		img.Close()
+	}
+
+	return fcs, nil
+}
+
+// detectProfiles finds faces turned to the side, the profile cascade only
+// detects faces turned towards the left of the image so faces turned to the
+// right are found by flipping the frame
+func (fp *FaceProcessor) detectProfiles(img gocv.Mat, src image.Image) ([]Face, error) {
+	if fp.profileclassifier == nil {
+		return nil, nil
+	}
+
+	fcs := fp.detect(fp.profileclassifier, img, OrientationLeft, fp.search)
+
+	m := mirror{width: src.Bounds().Dx()}
+	flipped, err := toMat(m.flipImage(src))
+	if err != nil {
+		return nil, err
+	}
+	defer flipped.Close()
+
+	for _, f := range fp.detect(fp.profileclassifier, flipped, OrientationRight, fp.search) {
+		fcs = append(fcs, mapFace(m, f))
+	}
+
+	return fcs, nil
+}
+
+// mergeFaces combines detections of the same face, verified faces are
+// preferred followed by the face with the highest confidence
+func mergeFaces(faces []Face, threshold float64) []Face {
+	rects := make([]image.Rectangle, len(faces))
+	scores := make([]float64, len(faces))
+
+	for i, f := range faces {
+		rects[i] = f.Rect
+		scores[i] = f.Confidence
+		if f.Accepted() {
+			scores[i]++
+		}
+	}
+
+	_, groups := MergeRectangles(rects, scores, MergeNMS, threshold)
+
+	merged := make([]Face, 0, len(groups))
+	for _, g := range groups {
+		f := faces[g[0]]
+		for _, i := range g[1:] {
+			f.Evidence.Neighbours += faces[i].Evidence.Neighbours
+		}
+
+		merged = append(merged, f)
+	}
+
+	return merged
+}
+
+// drawFace outlines the face on img, faces found in a rotated frame are drawn
+// as a rotated box
+func drawFace(img gocv.Mat, f *Face) {
+	if f.Corners == nil {
+		gocv.Rectangle(img, f.Rect, blue, 1)
+		return
+	}
+
+	for i := range f.Corners {
+		gocv.Line(img, f.Corners[i], f.Corners[(i+1)%len(f.Corners)], blue, 1)
+	}
+}
 
-		return fcs, bds
+// offsetRectangles converts rectangles found within a region to the
+// coordinates of the whole frame
+func offsetRectangles(rects []image.Rectangle, offset image.Point) []image.Rectangle {
+	out := make([]image.Rectangle, len(rects))
+	for i, r := range rects {
+		out[i] = r.Add(offset)
 	}
 
-	return nil, bds
+	return out
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	messages "github.com/nicholasjackson/drone-messages"
+)
+
+// MessageDroneImageDown is the subject for frames from the downward camera, it
+// accepts the same payload formats and subject suffixes as
+// messages.MessageDroneImage
+const MessageDroneImageDown = "image.down"
+
+// PayloadFormat is the encoding of a drone image message
+type PayloadFormat string
+
+// Payload formats can be set explicitly by publishing to the drone image
+// subject with the format as a suffix i.e. image.new.jpeg, when no suffix is
+// present the format is detected from the payload
+const (
+	PayloadAuto    PayloadFormat = "auto"
+	PayloadGobGzip PayloadFormat = "gobgz" // gob encoded DroneImage with gzipped data
+	PayloadGob     PayloadFormat = "gob"   // gob encoded DroneImage with raw image data
+	PayloadGzip    PayloadFormat = "gz"    // gzipped jpeg or png
+	PayloadJPEG    PayloadFormat = "jpeg"
+	PayloadPNG     PayloadFormat = "png"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+	pngMagic  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+)
+
+// maxImageSize is the largest uncompressed image accepted in bytes
+const maxImageSize = 32 << 20
+
+var (
+	errImageTooLarge  = errors.New("uncompressed image is too large")
+	errUnknownPayload = errors.New("unrecognised payload format")
+	errUnknownImage   = errors.New("unrecognised image format, expected jpeg or png")
+)
+
+// payloadFormatFromSubject returns the payload format from the subject suffix
+func payloadFormatFromSubject(subject string) (PayloadFormat, error) {
+	prefix := messages.MessageDroneImage
+	if strings.HasPrefix(subject, MessageDroneImageDown) {
+		prefix = MessageDroneImageDown
+	}
+
+	if subject == prefix {
+		return PayloadAuto, nil
+	}
+
+	switch f := PayloadFormat(strings.TrimPrefix(subject, prefix+".")); f {
+	case PayloadAuto, PayloadGobGzip, PayloadGob, PayloadGzip, PayloadJPEG, PayloadPNG:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unknown payload format in subject %s", subject)
+}
+
+// decodePayload returns the raw image data from a drone image message, when
+// the format is explicit the data must be in that format
+func decodePayload(format PayloadFormat, data []byte) ([]byte, error) {
+	switch format {
+	case PayloadAuto:
+		if f := detectPayloadFormat(data); f != "" {
+			return decodeImageData(data)
+		}
+
+		// anything which is not an image must be a gob encoded DroneImage
+		di := messages.DroneImage{}
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&di); err != nil {
+			return nil, errUnknownPayload
+		}
+
+		return decodeImageData(di.Data)
+	case PayloadJPEG, PayloadPNG:
+		if detectPayloadFormat(data) != format {
+			return nil, fmt.Errorf("payload is not %s", format)
+		}
+
+		return data, nil
+	case PayloadGzip:
+		return gunzipImage(data)
+	case PayloadGob, PayloadGobGzip:
+		di := messages.DroneImage{}
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&di); err != nil {
+			return nil, fmt.Errorf("unable to decode drone image: %s", err)
+		}
+
+		if format == PayloadGobGzip {
+			return gunzipImage(di.Data)
+		}
+
+		if f := detectPayloadFormat(di.Data); f != PayloadJPEG && f != PayloadPNG {
+			return nil, errUnknownImage
+		}
+
+		return di.Data, nil
+	}
+
+	return nil, errUnknownPayload
+}
+
+// detectPayloadFormat inspects the data to determine if it is a raw or
+// gzipped image, an empty format is returned for anything else
+func detectPayloadFormat(data []byte) PayloadFormat {
+	switch {
+	case bytes.HasPrefix(data, jpegMagic):
+		return PayloadJPEG
+	case bytes.HasPrefix(data, pngMagic):
+		return PayloadPNG
+	case bytes.HasPrefix(data, gzipMagic):
+		return PayloadGzip
+	}
+
+	return ""
+}
+
+// decodeImageData uncompresses data if it is gzipped and checks that the
+// result is an image which can be read by OpenCV
+func decodeImageData(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, gzipMagic) {
+		var err error
+		data, err = gunzip(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to uncompress image: %s", err)
+		}
+	}
+
+	if !bytes.HasPrefix(data, jpegMagic) && !bytes.HasPrefix(data, pngMagic) {
+		return nil, errUnknownImage
+	}
+
+	return data, nil
+}
+
+// gunzipImage uncompresses gzipped data which must contain an image
+func gunzipImage(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return nil, errors.New("payload is not gzipped")
+	}
+
+	return decodeImageData(data)
+}
+
+// gunzip returns the uncompressed contents of data, data which uncompresses
+// to more than maxImageSize is rejected
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := ioutil.ReadAll(io.LimitReader(zr, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) > maxImageSize {
+		return nil, errImageTooLarge
+	}
+
+	return out, nil
+}
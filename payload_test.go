@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"testing"
+
+	messages "github.com/nicholasjackson/drone-messages"
+)
+
+var (
+	testJPEG = append(append([]byte{}, jpegMagic...), "jpeg data"...)
+	testPNG  = append(append([]byte{}, pngMagic...), "png data"...)
+)
+
+func gzipData(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+
+	return b.Bytes()
+}
+
+func gobImage(data []byte) []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(messages.DroneImage{Data: data})
+
+	return b.Bytes()
+}
+
+func TestDecodesPayloadFormats(t *testing.T) {
+	cases := []struct {
+		format PayloadFormat
+		data   []byte
+		valid  bool
+	}{
+		{PayloadAuto, testJPEG, true},
+		{PayloadAuto, gzipData(testPNG), true},
+		{PayloadAuto, gobImage(testJPEG), true},
+		{PayloadAuto, []byte("not an image"), false},
+		{PayloadJPEG, testJPEG, true},
+		{PayloadJPEG, testPNG, false},
+		{PayloadJPEG, gzipData(testJPEG), false},
+		{PayloadPNG, testPNG, true},
+		{PayloadPNG, testJPEG, false},
+		{PayloadGzip, gzipData(testJPEG), true},
+		{PayloadGzip, testJPEG, false},
+		{PayloadGzip, gzipData([]byte("not an image")), false},
+		{PayloadGob, gobImage(testPNG), true},
+		{PayloadGob, gobImage(gzipData(testPNG)), false},
+		{PayloadGob, testJPEG, false},
+		{PayloadGobGzip, gobImage(gzipData(testJPEG)), true},
+		{PayloadGobGzip, gobImage(testJPEG), false},
+	}
+
+	for i, tc := range cases {
+		data, err := decodePayload(tc.format, tc.data)
+		if tc.valid && err != nil {
+			t.Errorf("case %d: expected %s payload to decode, got %s", i, tc.format, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("case %d: expected %s payload to be rejected", i, tc.format)
+		}
+
+		if tc.valid && !bytes.Equal(data, testJPEG) && !bytes.Equal(data, testPNG) {
+			t.Errorf("case %d: expected the raw image, got %q", i, data)
+		}
+	}
+}
+
+func TestRejectsOversizedGzip(t *testing.T) {
+	data := gzipData(make([]byte, maxImageSize+1))
+
+	if _, err := gunzip(data); err != errImageTooLarge {
+		t.Errorf("expected %s, got %v", errImageTooLarge, err)
+	}
+}
+
+func TestPayloadFormatFromSubject(t *testing.T) {
+	cases := map[string]PayloadFormat{
+		messages.MessageDroneImage:              PayloadAuto,
+		messages.MessageDroneImage + ".jpeg":    PayloadJPEG,
+		messages.MessageDroneImage + ".gobgz":   PayloadGobGzip,
+		MessageDroneImageDown:                   PayloadAuto,
+		MessageDroneImageDown + ".png":          PayloadPNG,
+		messages.MessageDroneImage + ".unknown": "",
+	}
+
+	for subject, want := range cases {
+		f, err := payloadFormatFromSubject(subject)
+		if want == "" && err == nil {
+			t.Errorf("expected %s to be rejected", subject)
+		}
+
+		if f != want {
+			t.Errorf("expected %s to have format %q, got %q", subject, want, f)
+		}
+	}
+}
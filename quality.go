@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// MessageExposureHint is the name of a message suggesting an exposure
+// adjustment to the drone camera
+const MessageExposureHint = "drone.camera.exposure"
+
+// qualityWidth is the width frames are reduced to before their quality is
+// measured, the per pixel statistics are calculated in Go
+const qualityWidth = 320
+
+// QualityAction defines what happens to frames which fail the quality checks
+type QualityAction string
+
+const (
+	// QualityOff disables quality assessment
+	QualityOff QualityAction = "off"
+	// QualityFlag runs detection on every frame and reports the quality
+	QualityFlag QualityAction = "flag"
+	// QualitySkip does not run detection on frames which fail the checks
+	QualitySkip QualityAction = "skip"
+)
+
+// QualityConfig configures the frame quality assessor
+type QualityConfig struct {
+	Action QualityAction
+	// MinSharpness is the minimum variance of the Laplacian
+	MinSharpness float64
+	// MinBrightness and MaxBrightness bound the mean brightness, 0 to 255
+	MinBrightness float64
+	MaxBrightness float64
+	// MaxClipped is the maximum fraction of pixels which are black or white
+	MaxClipped float64
+	// MinContrast is the minimum standard deviation of the brightness
+	MinContrast float64
+	// ExposureHints publishes exposure adjustments for the drone camera
+	ExposureHints bool
+}
+
+// Validate checks the quality settings
+func (c QualityConfig) Validate() error {
+	switch c.Action {
+	case QualityOff, QualityFlag, QualitySkip:
+		return nil
+	}
+
+	return fmt.Errorf("unknown quality action %s, expected off, flag or skip", c.Action)
+}
+
+// FrameQuality holds the quality scores for a frame
+type FrameQuality struct {
+	Sharpness  float64
+	Brightness float64
+	Contrast   float64
+	// Highlights and Shadows are the fraction of clipped white and black pixels
+	Highlights float64
+	Shadows    float64
+	// Passed is false when the frame failed any of the checks, Reasons lists
+	// the failed checks
+	Passed  bool
+	Reasons []string
+}
+
+// ExposureHint suggests an exposure change to the drone camera, Adjustment
+// is in stops, positive to brighten the image
+type ExposureHint struct {
+	Adjustment float64
+	Brightness float64
+	Highlights float64
+	Shadows    float64
+}
+
+// assessQuality measures the sharpness, exposure and contrast of img
+func (c QualityConfig) assessQuality(img gocv.Mat) *FrameQuality {
+	gray := gocv.NewMat()
+	defer gray.Close()
+
+	gocv.CvtColor(img, gray, gocv.ColorBGRToGray)
+	if gray.Cols() > qualityWidth {
+		scale := float64(qualityWidth) / float64(gray.Cols())
+		gocv.Resize(gray, gray, image.Point{}, scale, scale, gocv.InterpolationArea)
+	}
+
+	lap := gocv.NewMat()
+	defer lap.Close()
+	gocv.Laplacian(gray, lap, int(gocv.MatTypeCV64F), 1, 1, 0, gocv.BorderDefault)
+
+	var sum, sumSq, lapSum, lapSumSq, highlights, shadows float64
+	for y := 0; y < gray.Rows(); y++ {
+		for x := 0; x < gray.Cols(); x++ {
+			v := float64(uint8(gray.GetUCharAt(y, x)))
+			sum += v
+			sumSq += v * v
+
+			switch {
+			case v >= 250:
+				highlights++
+			case v <= 5:
+				shadows++
+			}
+
+			l := lap.GetDoubleAt(y, x)
+			lapSum += l
+			lapSumSq += l * l
+		}
+	}
+
+	n := float64(gray.Rows() * gray.Cols())
+	if n == 0 {
+		return &FrameQuality{Reasons: []string{"empty"}}
+	}
+
+	mean := sum / n
+	lapMean := lapSum / n
+
+	q := &FrameQuality{
+		Sharpness:  lapSumSq/n - lapMean*lapMean,
+		Brightness: mean,
+		Contrast:   math.Sqrt(math.Max(sumSq/n-mean*mean, 0)),
+		Highlights: highlights / n,
+		Shadows:    shadows / n,
+	}
+
+	q.Reasons = c.check(q)
+	q.Passed = len(q.Reasons) == 0
+
+	return q
+}
+
+// check returns the names of the checks the frame failed
+func (c QualityConfig) check(q *FrameQuality) []string {
+	reasons := make([]string, 0)
+
+	if q.Sharpness < c.MinSharpness {
+		reasons = append(reasons, "blurred")
+	}
+
+	if q.Brightness < c.MinBrightness {
+		reasons = append(reasons, "underexposed")
+	}
+
+	if q.Brightness > c.MaxBrightness {
+		reasons = append(reasons, "overexposed")
+	}
+
+	if q.Highlights+q.Shadows > c.MaxClipped {
+		reasons = append(reasons, "clipped")
+	}
+
+	if q.Contrast < c.MinContrast {
+		reasons = append(reasons, "low contrast")
+	}
+
+	return reasons
+}
+
+// exposureHint suggests the exposure change needed to bring the brightness to
+// mid grey, nil is returned when no change is needed
+func (q *FrameQuality) exposureHint(c QualityConfig) *ExposureHint {
+	if q.Brightness >= c.MinBrightness && q.Brightness <= c.MaxBrightness && q.Highlights+q.Shadows <= c.MaxClipped {
+		return nil
+	}
+
+	return &ExposureHint{
+		Adjustment: math.Log2(128 / math.Max(q.Brightness, 1)),
+		Brightness: q.Brightness,
+		Highlights: q.Highlights,
+		Shadows:    q.Shadows,
+	}
+}
+
+// recordQuality publishes the scores for the frame as metrics
+func recordQuality(q *FrameQuality) {
+	metricSharpness.Set(q.Sharpness)
+	metricBrightness.Set(q.Brightness)
+	metricContrast.Set(q.Contrast)
+
+	for _, r := range q.Reasons {
+		metricLowQuality.Add(r, 1)
+	}
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (eh *ExposureHint) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(eh)
+
+	return b.Bytes()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// errQueueFull is returned when a frame can not be added to a saturated queue
+var errQueueFull = errors.New("frame queue is full")
+
+// frame is a single image waiting to be processed
+type frame struct {
+	DroneID  string
+	Source   string
+	Data     []byte // raw image data
+	Down     bool   // true for frames from the downward camera
+	Received time.Time
+}
+
+// FrameQueue buffers frames received from NATS or the HTTP ingest endpoint
+// so that they can be processed one at a time by the face processor
+type FrameQueue struct {
+	frames chan *frame
+}
+
+// NewFrameQueue creates a new queue which holds at most size frames
+func NewFrameQueue(size int) *FrameQueue {
+	if size < 1 {
+		size = 1
+	}
+
+	return &FrameQueue{
+		frames: make(chan *frame, size),
+	}
+}
+
+// Enqueue adds a frame to the queue without blocking, if the queue is
+// saturated errQueueFull is returned and the frame is discarded
+func (q *FrameQueue) Enqueue(f *frame) error {
+	select {
+	case q.frames <- f:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Run calls process for each frame in the queue, it blocks until the queue is
+// closed
+func (q *FrameQueue) Run(process func(f *frame)) {
+	for f := range q.frames {
+		process(f)
+	}
+}
+
+// Close stops the queue from accepting any more frames
+func (q *FrameQueue) Close() {
+	close(q.frames)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"image"
+)
+
+// FaceResult is published on messages.MessageFaceDetection, it is gob
+// compatible with messages.FaceDetected so existing consumers can continue to
+// decode it as a FaceDetected message and ignore the additional fields
+type FaceResult struct {
+	// DroneID identifies the drone the frame was received from
+	DroneID string
+	// Faces contains the rectangles of the accepted faces and of confirmed
+	// faces which are coasting through a missed detection
+	Faces  []image.Rectangle
+	Bounds image.Rectangle
+	// Details contains every candidate face with its confidence and evidence
+	// so that consumers can apply their own threshold
+	Details []Face
+	// Quality holds the quality scores of the frame when quality assessment
+	// is enabled
+	Quality *FrameQuality
+	// LowLight is true when the frame was enhanced by the low light profile
+	LowLight bool
+	// QualityLevel is the detection quality level used for the frame, 0 is
+	// full quality and higher levels trade accuracy for latency
+	QualityLevel int
+}
+
+// NewFaceResult creates a result from the detected faces
+func NewFaceResult(d *Detection) *FaceResult {
+	fr := &FaceResult{
+		Faces:        make([]image.Rectangle, 0),
+		Bounds:       d.Bounds,
+		Details:      d.Faces,
+		Quality:      d.Quality,
+		LowLight:     d.LowLight,
+		QualityLevel: d.QualityLevel,
+	}
+
+	for _, f := range d.Faces {
+		if f.Accepted() || f.Coasting {
+			fr.Faces = append(fr.Faces, f.Rect)
+		}
+	}
+
+	return fr
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (fr *FaceResult) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(fr)
+
+	return b.Bytes()
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (fr *FaceResult) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(fr)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// ROIConfig configures region of interest search, once a face has been found
+// later frames only search a window around its predicted position and fall
+// back to a full frame scan when a face is lost or periodically
+type ROIConfig struct {
+	Enabled bool
+	// Expand is the fraction of the face size added to each side of the face
+	// to create the search window
+	Expand float64
+	// FullScanInterval is the maximum number of frames between full scans
+	FullScanInterval int
+}
+
+// roiScale is the scale step used when searching a window, the scale range is
+// narrow so a coarser step is sufficient
+const roiScale = 1.1
+
+// roiTrack is the last position and velocity of a face
+type roiTrack struct {
+	rect     image.Rectangle
+	velocity image.Point
+}
+
+// roiTracker predicts where faces will be in the next frame
+type roiTracker struct {
+	config        ROIConfig
+	tracks        []roiTrack
+	sinceFullScan int
+}
+
+// windows returns the search window for each tracked face, nil is returned
+// when a full scan is required
+func (t *roiTracker) windows(frame image.Rectangle) []image.Rectangle {
+	if !t.config.Enabled || len(t.tracks) == 0 || t.sinceFullScan >= t.config.FullScanInterval {
+		return nil
+	}
+
+	windows := make([]image.Rectangle, 0, len(t.tracks))
+	for _, tr := range t.tracks {
+		predicted := tr.rect.Add(tr.velocity)
+		dx := int(float64(predicted.Dx()) * t.config.Expand)
+		dy := int(float64(predicted.Dy()) * t.config.Expand)
+
+		w := predicted.Inset(-maxInt(dx, dy)).Intersect(frame)
+		if w.Empty() {
+			return nil
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows
+}
+
+// update records the verified faces found in the frame
+func (t *roiTracker) update(faces []Face, fullScan bool) {
+	if fullScan {
+		t.sinceFullScan = 0
+	} else {
+		t.sinceFullScan++
+	}
+
+	tracks := make([]roiTrack, 0)
+	for _, f := range faces {
+		if !f.Accepted() {
+			continue
+		}
+
+		tr := roiTrack{rect: f.Rect}
+		best := 0.0
+		for _, p := range t.tracks {
+			if iou := IoU(f.Rect, p.rect.Add(p.velocity)); iou > best {
+				best = iou
+				tr.velocity = center(f.Rect).Sub(center(p.rect))
+			}
+		}
+
+		tracks = append(tracks, tr)
+	}
+
+	t.tracks = tracks
+}
+
+// searchParamsFor returns cascade settings which only search for faces close
+// to the size of the tracked face, the resolution and verification of the
+// base settings are kept
+func searchParamsFor(window image.Rectangle, t roiTrack, base searchParams) searchParams {
+	size := t.rect.Size()
+
+	base.scale = roiScale
+	base.minSize = image.Point{X: size.X * 4 / 5, Y: size.Y * 4 / 5}
+	base.maxSize = image.Point{X: minInt(size.X*5/4, window.Dx()), Y: minInt(size.Y*5/4, window.Dy())}
+
+	return base
+}
+
+// detectROI searches the window around each tracked face, ok is false when
+// any of the tracked faces could not be found
+func (fp *FaceProcessor) detectROI(img gocv.Mat, windows []image.Rectangle) (faces []Face, ok bool) {
+	if windows == nil {
+		return nil, false
+	}
+
+	fcs := make([]Face, 0)
+
+	for i, w := range windows {
+		region := img.Region(w)
+		found := fp.detect(fp.faceclassifier, region, OrientationFrontal, searchParamsFor(w, fp.roi.tracks[i], fp.search))
+		region.Close()
+
+		verified := false
+		for _, f := range found {
+			verified = verified || f.Accepted()
+			fcs = append(fcs, mapFace(offset(w.Min), f))
+		}
+
+		if !verified {
+			metricROIMisses.Add(1)
+			return nil, false
+		}
+	}
+
+	metricROIHits.Add(1)
+	return mergeFaces(fcs, fp.config.MergeThreshold), true
+}
+
+// offset maps coordinates in a region back to the frame containing it
+type offset image.Point
+
+func (o offset) pointToFrame(p image.Point) image.Point {
+	return p.Add(image.Point(o))
+}
+
+func (o offset) rectToFrame(r image.Rectangle) image.Rectangle {
+	return r.Add(image.Point(o))
+}
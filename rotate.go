@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+)
+
+// rotation maps points between a frame and a copy of the frame rotated about
+// its centre, the rotated frame is enlarged so that no pixels are lost
+type rotation struct {
+	angle    float64
+	sin, cos float64
+	src, dst [2]float64 // centres of the original and rotated frames
+	size     image.Point
+}
+
+func newRotation(size image.Point, angle float64) rotation {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	w := math.Abs(float64(size.X)*cos) + math.Abs(float64(size.Y)*sin)
+	h := math.Abs(float64(size.X)*sin) + math.Abs(float64(size.Y)*cos)
+
+	return rotation{
+		angle: angle,
+		sin:   sin,
+		cos:   cos,
+		src:   [2]float64{float64(size.X) / 2, float64(size.Y) / 2},
+		dst:   [2]float64{w / 2, h / 2},
+		size:  image.Point{X: int(math.Ceil(w)), Y: int(math.Ceil(h))},
+	}
+}
+
+// toFrame maps a point in the rotated frame back to the original frame
+func (r rotation) toFrame(x, y float64) (float64, float64) {
+	x, y = x-r.dst[0], y-r.dst[1]
+	return x*r.cos + y*r.sin + r.src[0], -x*r.sin + y*r.cos + r.src[1]
+}
+
+// pointToFrame maps a point in the rotated frame back to the original frame
+func (r rotation) pointToFrame(p image.Point) image.Point {
+	x, y := r.toFrame(float64(p.X), float64(p.Y))
+	return image.Point{X: int(math.Floor(x + 0.5)), Y: int(math.Floor(y + 0.5))}
+}
+
+// cornersToFrame returns the corners of a rectangle in the rotated frame as a
+// rotated box in the original frame
+func (r rotation) cornersToFrame(rect image.Rectangle) []image.Point {
+	return []image.Point{
+		r.pointToFrame(rect.Min),
+		r.pointToFrame(image.Point{X: rect.Max.X, Y: rect.Min.Y}),
+		r.pointToFrame(rect.Max),
+		r.pointToFrame(image.Point{X: rect.Min.X, Y: rect.Max.Y}),
+	}
+}
+
+// rectToFrame returns the axis aligned bounds in the original frame of a
+// rectangle in the rotated frame
+func (r rotation) rectToFrame(rect image.Rectangle) image.Rectangle {
+	return boundsOf(r.cornersToFrame(rect))
+}
+
+// faceToFrame maps a face found in the rotated frame back to the original
+func (r rotation) faceToFrame(f Face) Face {
+	corners := r.cornersToFrame(f.Rect)
+
+	f = mapFace(r, f)
+	f.Corners = corners
+	f.Rotation = r.angle
+
+	return f
+}
+
+// rotateImage rotates src clockwise by the angle using bilinear sampling
+func (r rotation) rotateImage(src image.Image) *image.RGBA {
+	in := toRGBA(src)
+	out := image.NewRGBA(image.Rectangle{Max: r.size})
+	b := in.Bounds()
+
+	for y := 0; y < r.size.Y; y++ {
+		for x := 0; x < r.size.X; x++ {
+			sx, sy := r.toFrame(float64(x)+0.5, float64(y)+0.5)
+			sx, sy = sx-0.5, sy-0.5
+
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < b.Min.X || y0 < b.Min.Y || x0+1 >= b.Max.X || y0+1 >= b.Max.Y {
+				continue
+			}
+
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			o := out.PixOffset(x, y)
+			p00, p10 := in.PixOffset(x0, y0), in.PixOffset(x0+1, y0)
+			p01, p11 := in.PixOffset(x0, y0+1), in.PixOffset(x0+1, y0+1)
+
+			for c := 0; c < 4; c++ {
+				top := float64(in.Pix[p00+c])*(1-fx) + float64(in.Pix[p10+c])*fx
+				bottom := float64(in.Pix[p01+c])*(1-fx) + float64(in.Pix[p11+c])*fx
+				out.Pix[o+c] = uint8(top*(1-fy) + bottom*fy + 0.5)
+			}
+		}
+	}
+
+	return out
+}
+
+// ParseAngles parses a comma separated list of angles in degrees
+func ParseAngles(s string) ([]float64, error) {
+	angles := make([]float64, 0)
+	for _, v := range splitList(s) {
+		a, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid angle %s: %s", v, err)
+		}
+
+		angles = append(angles, a)
+	}
+
+	return angles, nil
+}
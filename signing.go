@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signDirective is the key file line which selects the signing key
+const signDirective = "sign"
+
+// nonceSize is the length in bytes of the random nonce in a signed message
+const nonceSize = 16
+
+var (
+	errUnsigned         = errors.New("message is not signed")
+	errUnknownKey       = errors.New("message is signed with an unknown key")
+	errInvalidSignature = errors.New("message signature is invalid")
+	errWrongSubject     = errors.New("message was signed for a different subject")
+	errStaleMessage     = errors.New("message timestamp is outside the allowed age")
+	errReplayedMessage  = errors.New("message has already been received")
+)
+
+// SignedMessage wraps a payload with a HMAC-SHA256 signature, KeyID identifies
+// the shared key used so that keys can be rotated without downtime. The
+// signature covers the subject, timestamp and nonce so that a captured message
+// can not be replayed later or on a different subject
+type SignedMessage struct {
+	KeyID     string
+	Subject   string
+	Timestamp int64 // unix time in nanoseconds when the message was signed
+	Nonce     []byte
+	Signature []byte
+	Payload   []byte
+}
+
+// EncodeMessage gob encodes the message and returns a byte slice
+func (sm *SignedMessage) EncodeMessage() []byte {
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(sm)
+
+	return b.Bytes()
+}
+
+// DecodeMessage decodes the message from gob byte slice
+func (sm *SignedMessage) DecodeMessage(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(sm)
+}
+
+// Keyring holds the shared keys used to sign and verify messages. Keys are
+// loaded from a file containing one key per line in the format
+// `<key id> <hex encoded key>` and an optional `sign <key id>` line selecting
+// the signing key. To rotate keys add the new key to the file and reload,
+// switch the sign line and reload, then remove the old key once all
+// publishers have been updated
+type Keyring struct {
+	path   string
+	maxAge time.Duration
+
+	mutex   sync.RWMutex
+	keys    map[string][]byte
+	signKey string
+	// fallback is the signing key used when the file has no sign line
+	fallback string
+
+	nonceMutex sync.Mutex
+	nonces     map[string]time.Time // nonces seen within maxAge
+}
+
+// NewKeyring creates a keyring from the key file at path, signKey is the id of
+// the key used to sign messages when the file does not select one and maxAge
+// is the largest difference between the time a message was signed and the
+// time it is verified
+func NewKeyring(path, signKey string, maxAge time.Duration) (*Keyring, error) {
+	k := &Keyring{
+		path:     path,
+		maxAge:   maxAge,
+		fallback: signKey,
+		nonces:   make(map[string]time.Time),
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload reads the keys and signing key from the key file replacing any
+// existing keys
+func (k *Keyring) Reload() error {
+	f, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keys := make(map[string][]byte)
+	signKey := k.fallback
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid key file line: %s", line)
+		}
+
+		if parts[0] == signDirective {
+			signKey = parts[1]
+			continue
+		}
+
+		key, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %s", parts[0], err)
+		}
+
+		keys[parts[0]] = key
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := keys[signKey]; signKey != "" && !ok {
+		return fmt.Errorf("signing key %s not found in %s", signKey, k.path)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.keys = keys
+	k.signKey = signKey
+	return nil
+}
+
+// CanSign returns true when a signing key has been configured
+func (k *Keyring) CanSign() bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.signKey != ""
+}
+
+// Sign wraps the payload for the subject in a SignedMessage signed with the
+// signing key
+func (k *Keyring) Sign(subject string, payload []byte) []byte {
+	k.mutex.RLock()
+	id := k.signKey
+	key := k.keys[id]
+	k.mutex.RUnlock()
+
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+
+	sm := SignedMessage{
+		KeyID:     id,
+		Subject:   subject,
+		Timestamp: time.Now().UnixNano(),
+		Nonce:     nonce,
+		Payload:   payload,
+	}
+	sm.Signature = sign(key, &sm)
+
+	return sm.EncodeMessage()
+}
+
+// Verify checks the signature of a SignedMessage received on subject and
+// returns the payload, messages signed for another subject, outside the
+// allowed age or which have already been received are rejected
+func (k *Keyring) Verify(subject string, data []byte) ([]byte, error) {
+	sm := SignedMessage{}
+	if err := sm.DecodeMessage(data); err != nil || len(sm.Signature) == 0 {
+		return nil, errUnsigned
+	}
+
+	k.mutex.RLock()
+	key, ok := k.keys[sm.KeyID]
+	k.mutex.RUnlock()
+
+	if !ok {
+		return nil, errUnknownKey
+	}
+
+	if !hmac.Equal(sm.Signature, sign(key, &sm)) {
+		return nil, errInvalidSignature
+	}
+
+	if sm.Subject != subject {
+		return nil, errWrongSubject
+	}
+
+	now := time.Now()
+	if age := now.Sub(time.Unix(0, sm.Timestamp)); age > k.maxAge || age < -k.maxAge {
+		return nil, errStaleMessage
+	}
+
+	if !k.firstUse(sm.KeyID+string(sm.Nonce), now) {
+		return nil, errReplayedMessage
+	}
+
+	return sm.Payload, nil
+}
+
+// firstUse records the nonce and returns false if it has been seen before,
+// nonces older than the maximum age are forgotten as their messages would be
+// rejected as stale
+func (k *Keyring) firstUse(nonce string, now time.Time) bool {
+	k.nonceMutex.Lock()
+	defer k.nonceMutex.Unlock()
+
+	for n, seen := range k.nonces {
+		if now.Sub(seen) > 2*k.maxAge {
+			delete(k.nonces, n)
+		}
+	}
+
+	if _, ok := k.nonces[nonce]; ok {
+		return false
+	}
+
+	k.nonces[nonce] = now
+	return true
+}
+
+// sign returns the HMAC of the message fields, variable length fields are
+// prefixed with their length so that fields can not be shifted between them
+func sign(key []byte, sm *SignedMessage) []byte {
+	mac := hmac.New(sha256.New, key)
+
+	for _, field := range [][]byte{[]byte(sm.KeyID), []byte(sm.Subject), sm.Nonce, sm.Payload} {
+		binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+
+	binary.Write(mac, binary.BigEndian, sm.Timestamp)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestKeyring(t *testing.T, contents string) (*Keyring, string) {
+	f, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteString(contents)
+	f.Close()
+
+	k, err := NewKeyring(f.Name(), "", time.Minute)
+	if err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+
+	return k, f.Name()
+}
+
+func TestVerifiesSignedMessage(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	data, err := k.Verify("drone.flight", k.Sign("drone.flight", []byte("land")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "land" {
+		t.Errorf("expected payload land, got %s", data)
+	}
+}
+
+func TestRejectsReplayedMessage(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	signed := k.Sign("drone.flight", []byte("land"))
+	if _, err := k.Verify("drone.flight", signed); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := k.Verify("drone.flight", signed); err != errReplayedMessage {
+		t.Errorf("expected %s, got %v", errReplayedMessage, err)
+	}
+}
+
+func TestRejectsMessageForOtherSubject(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	signed := k.Sign("image.facedetection", []byte("faces"))
+	if _, err := k.Verify("drone.flight", signed); err != errWrongSubject {
+		t.Errorf("expected %s, got %v", errWrongSubject, err)
+	}
+}
+
+func TestRejectsStaleMessage(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\n")
+	defer os.Remove(path)
+
+	sm := SignedMessage{KeyID: "a", Subject: "drone.flight", Timestamp: time.Now().Add(-time.Hour).UnixNano(), Nonce: []byte("n"), Payload: []byte("land")}
+	sm.Signature = sign(k.keys["a"], &sm)
+
+	if _, err := k.Verify("drone.flight", sm.EncodeMessage()); err != errStaleMessage {
+		t.Errorf("expected %s, got %v", errStaleMessage, err)
+	}
+}
+
+func TestRejectsTamperedMessage(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	sm := SignedMessage{}
+	sm.DecodeMessage(k.Sign("drone.flight", []byte("land")))
+	sm.Payload = []byte("takeoff")
+
+	if _, err := k.Verify("drone.flight", sm.EncodeMessage()); err != errInvalidSignature {
+		t.Errorf("expected %s, got %v", errInvalidSignature, err)
+	}
+}
+
+func TestRejectsUnsignedAndUnknownKey(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\n")
+	defer os.Remove(path)
+
+	if _, err := k.Verify("drone.flight", []byte("land")); err != errUnsigned {
+		t.Errorf("expected %s, got %v", errUnsigned, err)
+	}
+
+	sm := SignedMessage{KeyID: "b", Subject: "drone.flight", Timestamp: time.Now().UnixNano(), Signature: []byte("x")}
+	if _, err := k.Verify("drone.flight", sm.EncodeMessage()); err != errUnknownKey {
+		t.Errorf("expected %s, got %v", errUnknownKey, err)
+	}
+}
+
+func TestReloadSwitchesSigningKey(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nb 44556677\nsign a\n")
+	defer os.Remove(path)
+
+	ioutil.WriteFile(path, []byte("a 00112233\nb 44556677\nsign b\n"), 0600)
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := SignedMessage{}
+	sm.DecodeMessage(k.Sign("drone.flight", []byte("land")))
+	if sm.KeyID != "b" {
+		t.Errorf("expected signing key b, got %s", sm.KeyID)
+	}
+}
+
+func TestReloadRejectsMissingSigningKey(t *testing.T) {
+	k, path := newTestKeyring(t, "a 00112233\nsign a\n")
+	defer os.Remove(path)
+
+	ioutil.WriteFile(path, []byte("a 00112233\nsign c\n"), 0600)
+	if err := k.Reload(); err == nil {
+		t.Error("expected an error for a missing signing key")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// SkinMode defines how the skin colour filter is applied
+type SkinMode string
+
+const (
+	// SkinOff disables the skin colour filter
+	SkinOff SkinMode = "off"
+	// SkinReject discards candidate faces which contain too few skin pixels
+	SkinReject SkinMode = "reject"
+	// SkinRegions only searches skin coloured regions of the frame
+	SkinRegions SkinMode = "regions"
+)
+
+// SkinConfig configures the skin colour filter which reduces false positives
+// from foliage, brickwork and sky textures
+type SkinConfig struct {
+	Mode SkinMode
+	// ColorSpace used to classify skin pixels, hsv or ycrcb
+	ColorSpace string
+	// MinRatio is the minimum fraction of skin pixels in a face for reject mode
+	MinRatio float64
+	// MinRegionArea is the minimum area in pixels of a region in regions mode
+	MinRegionArea float64
+}
+
+// matTypeCV8UC3 is a Mat of three 8-bit unsigned channels, gocv does not
+// export it. Range bounds must have a channel for each image channel, a
+// single channel bound is applied to every channel
+const matTypeCV8UC3 gocv.MatType = 16
+
+// skin colour ranges, YCrCb is less sensitive to lighting than HSV
+var skinRanges = map[string][2]gocv.Scalar{
+	"ycrcb": {gocv.NewScalar(0, 133, 77, 0), gocv.NewScalar(255, 173, 127, 0)},
+	"hsv":   {gocv.NewScalar(0, 40, 60, 0), gocv.NewScalar(25, 255, 255, 0)},
+}
+
+// Validate checks the skin filter settings
+func (c SkinConfig) Validate() error {
+	switch c.Mode {
+	case SkinOff, SkinReject, SkinRegions:
+	default:
+		return fmt.Errorf("unknown skin filter mode %s, expected off, reject or regions", c.Mode)
+	}
+
+	if _, ok := skinRanges[c.ColorSpace]; !ok {
+		return fmt.Errorf("unknown skin colour space %s, expected hsv or ycrcb", c.ColorSpace)
+	}
+
+	return nil
+}
+
+// skinMask returns a binary mask where skin coloured pixels are 255
+func (c SkinConfig) skinMask(img gocv.Mat) gocv.Mat {
+	converted := gocv.NewMat()
+	defer converted.Close()
+
+	if c.ColorSpace == "hsv" {
+		gocv.CvtColor(img, converted, gocv.ColorBGRToHSV)
+	} else {
+		gocv.CvtColor(img, converted, gocv.ColorBGRToYCrCb)
+	}
+
+	r := skinRanges[c.ColorSpace]
+	mask := gocv.NewMat()
+	inRange(converted, r[0], r[1], mask)
+
+	// InRange produces 0 or 255 but smooth out isolated pixels before
+	// thresholding so that regions are not broken up by noise
+	gocv.MedianBlur(mask, mask, 5)
+	gocv.Threshold(mask, mask, 127, 255, gocv.ThresholdBinary)
+
+	return mask
+}
+
+// skinRatio returns the fraction of skin pixels in r
+func skinRatio(mask gocv.Mat, r image.Rectangle) float64 {
+	r = r.Intersect(image.Rect(0, 0, mask.Cols(), mask.Rows()))
+	if r.Empty() {
+		return 0
+	}
+
+	region := mask.Region(r)
+	defer region.Close()
+
+	return region.Mean().Val1 / 255
+}
+
+// rejectNonSkin removes faces which contain too few skin pixels
+func (c SkinConfig) rejectNonSkin(img gocv.Mat, faces []Face) []Face {
+	mask := c.skinMask(img)
+	defer mask.Close()
+
+	fcs := make([]Face, 0, len(faces))
+	for _, f := range faces {
+		if skinRatio(mask, f.Rect) < c.MinRatio {
+			metricSkinRejected.Add(1)
+			continue
+		}
+
+		fcs = append(fcs, f)
+	}
+
+	return fcs
+}
+
+// skinRegions returns the bounds of the skin coloured regions of the frame,
+// each region is expanded so that the whole face is searched
+func (c SkinConfig) skinRegions(img gocv.Mat) []image.Rectangle {
+	mask := c.skinMask(img)
+	defer mask.Close()
+
+	frame := image.Rect(0, 0, img.Cols(), img.Rows())
+	regions := make([]image.Rectangle, 0)
+
+	for _, contour := range gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple) {
+		if gocv.ContourArea(contour) < c.MinRegionArea {
+			continue
+		}
+
+		r := gocv.BoundingRect(contour)
+		regions = append(regions, r.Inset(-maxInt(r.Dx(), r.Dy())/4).Intersect(frame))
+	}
+
+	return regions
+}
+
+// detectSkinRegions searches only the skin coloured regions of the frame
+func (fp *FaceProcessor) detectSkinRegions(img gocv.Mat) []Face {
+	fcs := make([]Face, 0)
+
+	for _, r := range fp.config.Skin.skinRegions(img) {
+		metricSkinRegions.Add(1)
+
+		region := img.Region(r)
+		for _, f := range fp.detect(fp.faceclassifier, region, OrientationFrontal, fp.search) {
+			fcs = append(fcs, mapFace(offset(r.Min), f))
+		}
+		region.Close()
+	}
+
+	return mergeFaces(fcs, fp.config.MergeThreshold)
+}
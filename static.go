@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// StaticMode defines what happens to faces which never move relative to the
+// scene such as posters, photographs and screens
+type StaticMode string
+
+const (
+	// StaticOff disables static face suppression
+	StaticOff StaticMode = "off"
+	// StaticMark sets Static on static faces
+	StaticMark StaticMode = "mark"
+	// StaticDrop removes static faces from the results
+	StaticDrop StaticMode = "drop"
+)
+
+// StaticConfig configures static face suppression
+type StaticConfig struct {
+	Mode StaticMode
+	// MaxMotion is the largest motion in pixels per frame, relative to the
+	// global motion of the scene, which is considered to be still
+	MaxMotion float64
+	// Frames is the number of consecutive still frames before a face is
+	// considered static
+	Frames int
+}
+
+// Validate checks the static suppression settings
+func (c StaticConfig) Validate() error {
+	switch c.Mode {
+	case StaticOff, StaticMark, StaticDrop:
+	default:
+		return fmt.Errorf("unknown static mode %s, expected off, mark or drop", c.Mode)
+	}
+
+	if c.Frames < 1 {
+		return fmt.Errorf("static frames must be at least 1")
+	}
+
+	if c.MaxMotion < 0 {
+		return fmt.Errorf("static max motion must not be negative")
+	}
+
+	return nil
+}
+
+type staticTrack struct {
+	rect  image.Rectangle
+	still int
+}
+
+// staticSuppressor learns detections which persist without moving relative
+// to the scene, real people move slightly even when standing still
+type staticSuppressor struct {
+	config StaticConfig
+	flow   opticalFlow
+	tracks []staticTrack
+}
+
+// apply marks or drops the static faces in the frame
+func (s *staticSuppressor) apply(img gocv.Mat, faces []Face) []Face {
+	mf, ok := s.flow.next(img)
+	if !ok {
+		s.tracks = nil
+		return faces
+	}
+	defer mf.Close()
+
+	gx, gy := mf.global()
+	shift := image.Point{X: int(gx), Y: int(gy)}
+
+	tracks := make([]staticTrack, 0)
+	fcs := make([]Face, 0, len(faces))
+
+	for _, f := range faces {
+		t := staticTrack{rect: f.Rect}
+
+		if mf.relative(f.Rect) <= s.config.MaxMotion {
+			// the face was still so continue the count of the track it matches
+			best := 0.3
+			for _, p := range s.tracks {
+				if iou := IoU(f.Rect, p.rect.Add(shift)); iou >= best {
+					best, t.still = iou, p.still
+				}
+			}
+
+			t.still++
+		}
+
+		tracks = append(tracks, t)
+
+		if t.still >= s.config.Frames {
+			metricStaticFaces.Add(1)
+			f.Static = true
+
+			if s.config.Mode == StaticDrop {
+				continue
+			}
+		}
+
+		fcs = append(fcs, f)
+	}
+
+	s.tracks = tracks
+	return fcs
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// TileConfig configures tiled detection, high resolution frames are split
+// into overlapping tiles which are searched in parallel so that small faces
+// can be found without scanning the whole frame at full resolution
+type TileConfig struct {
+	Enabled bool
+	// Size is the width and height of each tile in pixels
+	Size int
+	// Overlap is the number of pixels shared by neighbouring tiles, it should
+	// be at least the size of the largest face
+	Overlap int
+	// Workers is the number of tiles searched in parallel
+	Workers int
+}
+
+// Validate checks the tile settings, the overlap must leave a step between
+// tiles or the frame would be covered by a tile for every pixel
+func (c TileConfig) Validate() error {
+	if c.Size <= 0 {
+		return fmt.Errorf("tile size must be greater than 0")
+	}
+
+	if c.Overlap < 0 || c.Overlap >= c.Size {
+		return fmt.Errorf("tile overlap must be at least 0 and less than the tile size")
+	}
+
+	if c.Workers < 1 {
+		return fmt.Errorf("tile workers must be at least 1")
+	}
+
+	return nil
+}
+
+// tiles returns the overlapping tiles which cover the frame
+func (c TileConfig) tiles(frame image.Rectangle) []image.Rectangle {
+	step := c.Size - c.Overlap
+
+	tiles := make([]image.Rectangle, 0)
+	for y := frame.Min.Y; ; y += step {
+		for x := frame.Min.X; ; x += step {
+			tiles = append(tiles, image.Rect(x, y, x+c.Size, y+c.Size).Intersect(frame))
+
+			if x+c.Size >= frame.Max.X {
+				break
+			}
+		}
+
+		if y+c.Size >= frame.Max.Y {
+			break
+		}
+	}
+
+	return tiles
+}
+
+// newTileWorkers creates a face processor for each worker, OpenCV cascade
+// classifiers can not be shared between goroutines
+func newTileWorkers(config FaceProcessorConfig) []*FaceProcessor {
+	workers := config.Tiles.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// workers only search a single tile
+	config.Tiles = TileConfig{}
+	config.RotationAngles = nil
+	config.ProfileCascade = ""
+
+	fps := make([]*FaceProcessor, workers)
+	for i := range fps {
+		fps[i] = NewFaceProcessor(config)
+	}
+
+	return fps
+}
+
+// detectTiled searches each tile for frontal faces in parallel, faces cut by
+// the edge of a tile are discarded as the overlap ensures they are found
+// whole in a neighbouring tile, and duplicates found in the overlap are merged
+func (fp *FaceProcessor) detectTiled(img gocv.Mat) []Face {
+	frame := image.Rect(0, 0, img.Cols(), img.Rows())
+
+	tiles := make(chan image.Rectangle)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	fcs := make([]Face, 0)
+	for _, w := range fp.tileWorkers {
+		wg.Add(1)
+		go func(w *FaceProcessor) {
+			defer wg.Done()
+
+			for t := range tiles {
+				region := img.Region(t)
+				found := w.detect(w.faceclassifier, region, OrientationFrontal, fp.search)
+				region.Close()
+
+				mutex.Lock()
+				for _, f := range found {
+					f = mapFace(offset(t.Min), f)
+					if !touchesTileEdge(f.Rect, t, frame) {
+						fcs = append(fcs, f)
+					}
+				}
+				mutex.Unlock()
+			}
+		}(w)
+	}
+
+	for _, t := range fp.config.Tiles.tiles(frame) {
+		tiles <- t
+	}
+
+	close(tiles)
+	wg.Wait()
+
+	return mergeFaces(fcs, fp.config.MergeThreshold)
+}
+
+// touchesTileEdge returns true if r touches an edge of the tile which is not
+// also an edge of the frame
+func touchesTileEdge(r, tile, frame image.Rectangle) bool {
+	return (r.Min.X <= tile.Min.X && tile.Min.X > frame.Min.X) ||
+		(r.Min.Y <= tile.Min.Y && tile.Min.Y > frame.Min.Y) ||
+		(r.Max.X >= tile.Max.X && tile.Max.X < frame.Max.X) ||
+		(r.Max.Y >= tile.Max.Y && tile.Max.Y < frame.Max.Y)
+}
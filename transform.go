@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+
+	// register the decoders for the formats accepted by the payload decoder
+	_ "image/png"
+
+	"gocv.io/x/gocv"
+)
+
+// frameTransform maps coordinates in a transformed copy of a frame back to the
+// original frame
+type frameTransform interface {
+	pointToFrame(p image.Point) image.Point
+	rectToFrame(r image.Rectangle) image.Rectangle
+}
+
+// mapFace maps a face found in a transformed copy of the frame, along with its
+// evidence and landmarks, back to the original frame
+func mapFace(t frameTransform, f Face) Face {
+	f.Rect = t.rectToFrame(f.Rect)
+
+	e := &f.Evidence
+	e.Eyes = rectsToFrame(t, e.Eyes)
+	e.Glasses = rectsToFrame(t, e.Glasses)
+	e.Nose = rectsToFrame(t, e.Nose)
+	e.Mouth = rectsToFrame(t, e.Mouth)
+	e.Smile = rectsToFrame(t, e.Smile)
+
+	for i, p := range f.EyeCentres {
+		f.EyeCentres[i] = t.pointToFrame(p)
+	}
+
+	if f.Landmarks != nil {
+		f.Landmarks = newEyeLandmarks(t.pointToFrame(f.Landmarks.Left), t.pointToFrame(f.Landmarks.Right))
+	}
+
+	return f
+}
+
+func rectsToFrame(t frameTransform, rects []image.Rectangle) []image.Rectangle {
+	out := make([]image.Rectangle, len(rects))
+	for i, r := range rects {
+		out[i] = t.rectToFrame(r)
+	}
+
+	return out
+}
+
+// mirror maps coordinates in a horizontally flipped frame back to the
+// original frame
+type mirror struct {
+	width int
+}
+
+func (m mirror) pointToFrame(p image.Point) image.Point {
+	return image.Point{X: m.width - p.X, Y: p.Y}
+}
+
+func (m mirror) rectToFrame(r image.Rectangle) image.Rectangle {
+	return image.Rect(m.width-r.Max.X, r.Min.Y, m.width-r.Min.X, r.Max.Y)
+}
+
+// flipImage returns a horizontally flipped copy of src
+func (m mirror) flipImage(src image.Image) *image.RGBA {
+	in := toRGBA(src)
+	b := in.Bounds()
+	out := image.NewRGBA(image.Rectangle{Max: b.Size()})
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			s, d := in.PixOffset(b.Min.X+x, b.Min.Y+y), out.PixOffset(b.Dx()-1-x, y)
+			copy(out.Pix[d:d+4], in.Pix[s:s+4])
+		}
+	}
+
+	return out
+}
+
+// matImage converts an OpenCV Mat into a Go image, the Mat is encoded as a
+// lossless png and decoded with the Go image decoders
+func matImage(img gocv.Mat) (image.Image, error) {
+	buf, err := gocv.IMEncode(".png", img)
+	if err != nil {
+		return nil, err
+	}
+
+	i, _, err := image.Decode(bytes.NewReader(buf))
+	return i, err
+}
+
+// toMat converts a Go image into an OpenCV Mat, the gocv bindings can only
+// create a Mat from a file so the image is written to a temporary file
+func toMat(img image.Image) (gocv.Mat, error) {
+	f, err := ioutil.TempFile("", "frame")
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	defer os.Remove(f.Name())
+
+	err = jpeg.Encode(f, img, &jpeg.Options{Quality: 95})
+	f.Close()
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+
+	m := gocv.IMRead(f.Name(), gocv.IMReadColor)
+	if m.Empty() {
+		m.Close()
+		return gocv.Mat{}, errEmptyImage
+	}
+
+	return m, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	return rgba
+}
+
+// boundsOf returns the smallest rectangle containing all the points
+func boundsOf(points []image.Point) image.Rectangle {
+	r := image.Rectangle{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		r.Min.X, r.Min.Y = minInt(r.Min.X, p.X), minInt(r.Min.Y, p.Y)
+		r.Max.X, r.Max.Y = maxInt(r.Max.X, p.X), maxInt(r.Max.Y, p.Y)
+	}
+
+	return r
+}
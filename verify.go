@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VerifyMode defines the rule used to verify a candidate face from the
+// features found within it
+type VerifyMode string
+
+const (
+	// VerifyNone accepts every candidate face
+	VerifyNone VerifyMode = "none"
+	// VerifyAny accepts a face when any of the features are found
+	VerifyAny VerifyMode = "any"
+	// VerifyAll accepts a face when all of the features are found
+	VerifyAll VerifyMode = "all"
+	// VerifyWeighted accepts a face when the sum of the weights of the found
+	// features reaches the threshold
+	VerifyWeighted VerifyMode = "weighted"
+)
+
+// features which can be used as evidence when verifying a face
+const (
+	FeatureEyes    = "eyes"
+	FeatureGlasses = "glasses"
+	FeatureNose    = "nose"
+	FeatureMouth   = "mouth"
+	FeatureSmile   = "smile"
+)
+
+// VerificationPolicy decides if a candidate face is a real face
+type VerificationPolicy struct {
+	Mode VerifyMode
+	// Features used by the any and all modes
+	Features []string
+	// Weights and Threshold used by the weighted mode
+	Weights   map[string]float64
+	Threshold float64
+}
+
+// DefaultVerificationPolicy accepts faces which contain eyes or eyeglasses, it
+// is the default of the verify flags
+var DefaultVerificationPolicy = VerificationPolicy{
+	Mode:     VerifyAny,
+	Features: []string{FeatureEyes, FeatureGlasses},
+}
+
+// ParseVerificationPolicy creates a policy from its command line settings,
+// features is a comma separated list and weights a comma separated list of
+// feature=weight pairs
+func ParseVerificationPolicy(mode, features, weights string, threshold float64) (VerificationPolicy, error) {
+	p := VerificationPolicy{
+		Mode:      VerifyMode(mode),
+		Weights:   make(map[string]float64),
+		Threshold: threshold,
+	}
+
+	switch p.Mode {
+	case VerifyNone, VerifyAny, VerifyAll, VerifyWeighted:
+	default:
+		return p, fmt.Errorf("unknown verification mode %s, expected none, any, all or weighted", mode)
+	}
+
+	for _, f := range splitList(features) {
+		if !validFeature(f) {
+			return p, fmt.Errorf("unknown verification feature %s", f)
+		}
+
+		p.Features = append(p.Features, f)
+	}
+
+	for _, w := range splitList(weights) {
+		parts := strings.SplitN(w, "=", 2)
+		if len(parts) != 2 || !validFeature(parts[0]) {
+			return p, fmt.Errorf("invalid verification weight %s", w)
+		}
+
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid verification weight %s: %s", w, err)
+		}
+
+		p.Weights[parts[0]] = v
+	}
+
+	return p, nil
+}
+
+// Verify returns true when the features found satisfy the policy, found
+// contains the number of detections for each feature
+func (p VerificationPolicy) Verify(found map[string]int) bool {
+	switch p.Mode {
+	case VerifyNone:
+		return true
+	case VerifyAny:
+		for _, f := range p.Features {
+			if found[f] > 0 {
+				return true
+			}
+		}
+
+		return false
+	case VerifyAll:
+		for _, f := range p.Features {
+			if found[f] == 0 {
+				return false
+			}
+		}
+
+		return len(p.Features) > 0
+	case VerifyWeighted:
+		var total float64
+		for f, w := range p.Weights {
+			if found[f] > 0 {
+				total += w
+			}
+		}
+
+		return total >= p.Threshold
+	}
+
+	return false
+}
+
+// String returns a short description of the policy
+func (p VerificationPolicy) String() string {
+	switch p.Mode {
+	case VerifyAny, VerifyAll:
+		return fmt.Sprintf("%s(%s)", p.Mode, strings.Join(p.Features, ","))
+	case VerifyWeighted:
+		return fmt.Sprintf("%s(%v>=%.2f)", p.Mode, p.Weights, p.Threshold)
+	}
+
+	return string(p.Mode)
+}
+
+// Uses returns true if the policy depends on the given feature
+func (p VerificationPolicy) Uses(feature string) bool {
+	if p.Mode == VerifyWeighted {
+		_, ok := p.Weights[feature]
+		return ok
+	}
+
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// featureCounts returns the number of detections of each feature in the
+// evidence for a face
+func featureCounts(e FaceEvidence) map[string]int {
+	return map[string]int{
+		FeatureEyes:    len(e.Eyes),
+		FeatureGlasses: len(e.Glasses),
+		FeatureNose:    len(e.Nose),
+		FeatureMouth:   len(e.Mouth),
+		FeatureSmile:   len(e.Smile),
+	}
+}
+
+func validFeature(f string) bool {
+	switch f {
+	case FeatureEyes, FeatureGlasses, FeatureNose, FeatureMouth, FeatureSmile:
+		return true
+	}
+
+	return false
+}
+
+func splitList(s string) []string {
+	out := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}